@@ -4,9 +4,6 @@ import (
 	"os"
 	"strconv"
 	"strings"
-	"time"
-
-	"github.com/dgv/clipboard"
 )
 
 func (v *View) deselect(index int) bool {
@@ -34,7 +31,7 @@ func (v *View) Center() bool {
 // CursorUp moves the cursor up
 func (v *View) CursorUp() bool {
 	v.deselect(0)
-	v.Cursor.Up()
+	v.cursorUpN(1)
 
 	return true
 }
@@ -42,7 +39,7 @@ func (v *View) CursorUp() bool {
 // CursorDown moves the cursor down
 func (v *View) CursorDown() bool {
 	v.deselect(1)
-	v.Cursor.Down()
+	v.cursorUpN(-1)
 
 	return true
 }
@@ -90,7 +87,7 @@ func (v *View) SelectUp() bool {
 	if !v.Cursor.HasSelection() {
 		v.Cursor.OrigSelection[0] = v.Cursor.Loc
 	}
-	v.Cursor.Up()
+	v.cursorUpN(1)
 	v.Cursor.SelectTo(v.Cursor.Loc)
 
 	return true
@@ -101,7 +98,7 @@ func (v *View) SelectDown() bool {
 	if !v.Cursor.HasSelection() {
 		v.Cursor.OrigSelection[0] = v.Cursor.Loc
 	}
-	v.Cursor.Down()
+	v.cursorUpN(-1)
 	v.Cursor.SelectTo(v.Cursor.Loc)
 
 	return true
@@ -182,6 +179,7 @@ func (v *View) SelectToEndOfLine() bool {
 // CursorStart moves the cursor to the start of the buffer
 func (v *View) CursorStart() bool {
 	v.deselect(0)
+	v.recordJump()
 
 	v.Cursor.X = 0
 	v.Cursor.Y = 0
@@ -192,6 +190,7 @@ func (v *View) CursorStart() bool {
 // CursorEnd moves the cursor to the end of the buffer
 func (v *View) CursorEnd() bool {
 	v.deselect(0)
+	v.recordJump()
 
 	v.Cursor.Loc = v.Buf.End()
 
@@ -253,7 +252,14 @@ func (v *View) Backspace() bool {
 	if v.Cursor.HasSelection() {
 		v.Cursor.DeleteSelection()
 		v.Cursor.ResetSelection()
+	} else if v.Buf.IsEmptyPair(v.Cursor.Loc) {
+		// Remove both halves of an empty pair
+		loc := v.Cursor.Loc
+		v.Buf.Remove(Loc{loc.X - 1, loc.Y}, Loc{loc.X + 1, loc.Y})
+		v.Cursor.X--
+		v.shiftAutoClose(loc.Y, loc.X-1, -2)
 	} else if v.Cursor.Loc.GreaterThan(v.Buf.Start()) {
+		v.shiftAutoClose(v.Cursor.Y, v.Cursor.X-1, -1)
 		v.Cursor.Left()
 		cx, cy := v.Cursor.X, v.Cursor.Y
 		v.Cursor.Right()
@@ -297,6 +303,118 @@ func (v *View) InsertTab() bool {
 	return true
 }
 
+// shiftSelectionX moves the ends of the selection that are on line y and not
+// at the start of it by n columns
+func (v *View) shiftSelectionX(y, n int) {
+	for i := range v.Cursor.CurSelection {
+		if sel := &v.Cursor.CurSelection[i]; sel.Y == y && sel.X > 0 {
+			sel.X = Max(0, sel.X+n)
+		}
+	}
+	v.Cursor.OrigSelection = v.Cursor.CurSelection
+}
+
+// IndentSelection indents the selected lines by one level
+func (v *View) IndentSelection() bool {
+	if !v.Cursor.HasSelection() {
+		return false
+	}
+
+	indent := v.Buf.IndentString()
+	first, last := v.Cursor.SelectedLines()
+	var deltas []Delta
+	for y := first; y <= last; y++ {
+		if len(v.Buf.Line(y)) == 0 {
+			continue
+		}
+		deltas = append(deltas, Delta{indent, Loc{0, y}, Loc{0, y}})
+		v.shiftSelectionX(y, Count(indent))
+	}
+	if len(deltas) == 0 {
+		return false
+	}
+	v.Buf.MultipleReplace(deltas)
+	v.Cursor.Loc = v.Cursor.CurSelection[1]
+
+	return true
+}
+
+// OutdentSelection removes one level of indentation from the selected lines
+func (v *View) OutdentSelection() bool {
+	if !v.Cursor.HasSelection() {
+		return false
+	}
+
+	first, last := v.Cursor.SelectedLines()
+	var deltas []Delta
+	for y := first; y <= last; y++ {
+		ws := []rune(GetLeadingWhitespace(v.Buf.Line(y)))
+		n := 0
+		if len(ws) > 0 && ws[0] == '\t' {
+			n = 1
+		} else {
+			for n < len(ws) && n < v.Buf.IntOption("tabsize") && ws[n] == ' ' {
+				n++
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		deltas = append(deltas, Delta{"", Loc{0, y}, Loc{n, y}})
+		v.shiftSelectionX(y, -n)
+	}
+	if len(deltas) == 0 {
+		return false
+	}
+	v.Buf.MultipleReplace(deltas)
+	v.Cursor.Loc = v.Cursor.CurSelection[1]
+
+	return true
+}
+
+// moveLines swaps the current or selected lines with the line above (dir -1)
+// or below (dir 1) them, keeping the selection on the moved lines
+func (v *View) moveLines(dir int) bool {
+	first, last := v.Cursor.SelectedLines()
+	if first+dir < 0 || last+dir >= v.Buf.NumLines {
+		return false
+	}
+
+	lines := strings.Join(v.Buf.Lines(first, last+1), "\n")
+	var start, end Loc
+	var text string
+	if dir < 0 {
+		other := v.Buf.Line(first - 1)
+		start, end = Loc{0, first - 1}, Loc{Count(v.Buf.Line(last)), last}
+		text = lines + "\n" + other
+	} else {
+		other := v.Buf.Line(last + 1)
+		start, end = Loc{0, first}, Loc{Count(other), last + 1}
+		text = other + "\n" + lines
+	}
+	v.Buf.MultipleReplace([]Delta{{text, start, end}})
+
+	v.Cursor.Y += dir
+	for i := range v.Cursor.CurSelection {
+		v.Cursor.CurSelection[i].Y += dir
+	}
+	for i := range v.Cursor.OrigSelection {
+		v.Cursor.OrigSelection[i].Y += dir
+	}
+
+	return true
+}
+
+// MoveLinesUp moves the current line or the selected lines up by one line
+func (v *View) MoveLinesUp() bool {
+	return v.moveLines(-1)
+}
+
+// MoveLinesDown moves the current line or the selected lines down by one line
+func (v *View) MoveLinesDown() bool {
+	return v.moveLines(1)
+}
+
 // Save the buffer to disk
 func (v *View) Save() bool {
 	// If this is an empty buffer, ask for a filename
@@ -335,14 +453,28 @@ func (v *View) SaveAs() bool {
 
 // Find opens a prompt and searches forward for the input
 func (v *View) Find() bool {
+	return v.find(true)
+}
+
+// FindBackward opens a prompt and searches backward for the input
+func (v *View) FindBackward() bool {
+	return v.find(false)
+}
+
+func (v *View) find(down bool) bool {
 	searchStr := ""
 	if v.Cursor.HasSelection() {
-		searchStart = ToCharPos(v.Cursor.CurSelection[1], v.Buf)
-		searchStart = ToCharPos(v.Cursor.CurSelection[1], v.Buf)
+		if down {
+			searchStart = ToCharPos(v.Cursor.CurSelection[1], v.Buf)
+		} else {
+			searchStart = ToCharPos(v.Cursor.CurSelection[0], v.Buf)
+		}
 		searchStr = v.Cursor.GetSelection()
 	} else {
 		searchStart = ToCharPos(v.Cursor.Loc, v.Buf)
 	}
+	v.recordJump()
+	searchDown = down
 	BeginSearch(searchStr)
 
 	return true
@@ -358,6 +490,7 @@ func (v *View) FindNext() bool {
 	if lastSearch == "" {
 		return true
 	}
+	v.recordJump()
 	Search(lastSearch, v, true)
 
 	return true
@@ -370,6 +503,7 @@ func (v *View) FindPrevious() bool {
 	} else {
 		searchStart = ToCharPos(v.Cursor.Loc, v.Buf)
 	}
+	v.recordJump()
 	Search(lastSearch, v, false)
 
 	return true
@@ -420,27 +554,55 @@ func (v *View) CutLine() bool {
 	if !v.Cursor.HasSelection() {
 		return false
 	}
-	/*
-		if v.freshClip == true {
-			if v.Cursor.HasSelection() {
-				if clip, err := clipboard.ReadAll(); err != nil {
-					messenger.Error(err)
-				} else {
-					clipboard.WriteAll(clip + v.Cursor.GetSelection())
-				}
-			}
-		} else if time.Since(v.lastCutTime)/time.Second > 10*time.Second || v.freshClip == false {
-			v.Copy()
+	v.killSelection()
+
+	return true
+}
+
+// KillLine cuts from the cursor to the end of the line, or the line break if
+// the cursor is at the end of the line. Consecutive kills accumulate in the
+// clipboard
+func (v *View) KillLine() bool {
+	end := Loc{Count(v.Buf.Line(v.Cursor.Y)), v.Cursor.Y}
+	if v.Cursor.Loc == end {
+		if v.Cursor.Y+1 >= v.Buf.NumLines {
+			return false
 		}
-		v.freshClip = true
-	*/
-	v.lastCutTime = time.Now()
-	v.Cursor.DeleteSelection()
-	v.Cursor.ResetSelection()
+		end = Loc{0, v.Cursor.Y + 1}
+	}
+	v.Cursor.SetSelectionStart(v.Cursor.Loc)
+	v.Cursor.SetSelectionEnd(end)
+	v.killSelection()
 
 	return true
 }
 
+// KillRegion cuts the selection to the clipboard. Consecutive kills
+// accumulate in the clipboard
+func (v *View) KillRegion() bool {
+	if !v.Cursor.HasSelection() {
+		return false
+	}
+	v.killSelection()
+
+	return true
+}
+
+// killSelection cuts the selection to the clipboard. Consecutive kills
+// accumulate in the clipboard, until a key that doesn't kill is pressed or
+// the clipboard is pasted
+func (v *View) killSelection() {
+	if (v.appendKills || v.killed) && v.freshClip {
+		appendKill(v.Cursor.GetSelection())
+		WriteClipboard(lastKill())
+	} else {
+		v.Copy()
+	}
+	v.killed = true
+	v.Cursor.DeleteSelection()
+	v.Cursor.ResetSelection()
+}
+
 // Cut the selection to the system clipboard
 func (v *View) Cut() bool {
 	if v.Cursor.HasSelection() {
@@ -483,8 +645,7 @@ func (v *View) DeleteLine() bool {
 // Paste whatever is in the system clipboard into the buffer
 // Delete and paste if the user has a selection
 func (v *View) Paste() bool {
-	clip, _ := clipboard.ReadAll()
-	v.paste(clip)
+	v.paste(ReadClipboard())
 
 	return true
 }
@@ -561,7 +722,7 @@ func (v *View) CursorPageUp() bool {
 		v.Cursor.Loc = v.Cursor.CurSelection[0]
 		v.Cursor.ResetSelection()
 	}
-	v.Cursor.UpN(v.Height)
+	v.cursorUpN(v.Height)
 
 	return true
 }
@@ -574,7 +735,7 @@ func (v *View) CursorPageDown() bool {
 		v.Cursor.Loc = v.Cursor.CurSelection[1]
 		v.Cursor.ResetSelection()
 	}
-	v.Cursor.DownN(v.Height)
+	v.cursorUpN(-v.Height)
 
 	return true
 }
@@ -594,6 +755,7 @@ func (v *View) GotoLine() bool {
 	}
 	// Move cursor and view if possible.
 	if lineint < v.Buf.NumLines && lineint >= 0 {
+		v.recordJump()
 		v.Cursor.X = 0
 		v.Cursor.Y = lineint
 
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// An Anchor is a location in a buffer that moves along with the text around
+// it as the buffer changes
+type Anchor struct {
+	Loc
+
+	// Whether text inserted right at the anchor goes after it. By default
+	// the anchor moves past inserted text
+	Left bool
+}
+
+// AddAnchor makes the buffer keep the anchor in place as it changes
+func (b *Buffer) AddAnchor(a *Anchor) {
+	b.anchors = append(b.anchors, a)
+}
+
+// RemoveAnchor stops the buffer from updating the anchor
+func (b *Buffer) RemoveAnchor(a *Anchor) {
+	for i, other := range b.anchors {
+		if other == a {
+			b.anchors = append(b.anchors[:i], b.anchors[i+1:]...)
+			return
+		}
+	}
+}
+
+// anchorsInserted moves the anchors after value was inserted at pos
+func (b *Buffer) anchorsInserted(pos Loc, value []byte) {
+	lines := bytes.Count(value, []byte{'\n'})
+	last := utf8.RuneCount(value[bytes.LastIndexByte(value, '\n')+1:])
+	for _, a := range b.anchors {
+		if a.Loc.LessThan(pos) || (a.Loc == pos && a.Left) {
+			continue
+		}
+		if a.Y == pos.Y {
+			if lines == 0 {
+				a.X += last
+			} else {
+				a.X = last + a.X - pos.X
+			}
+		}
+		a.Y += lines
+	}
+}
+
+// anchorsRemoved moves the anchors after the text from start to end was
+// removed. Anchors inside the removed text end up at start
+func (b *Buffer) anchorsRemoved(start, end Loc) {
+	for _, a := range b.anchors {
+		switch {
+		case a.Loc.LessEqual(start):
+		case a.Loc.LessThan(end):
+			a.Loc = start
+		case a.Y == end.Y:
+			a.Loc = Loc{start.X + a.X - end.X, start.Y}
+		default:
+			a.Y -= end.Y - start.Y
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+// autoPairs maps a file type to the pairs of characters that are closed
+// automatically when the opening one is typed, unless the autopairs option
+// gives others. Every two runes form a pair.
+// The "default" entry is used for file types without an entry of their own.
+var autoPairs = map[string]string{
+	"default":  "()[]{}\"\"''``",
+	"go":       "()[]{}\"\"''``",
+	"lisp":     "()[]{}\"\"",
+	"clojure":  "()[]{}\"\"",
+	"markdown": "()[]{}\"\"``",
+	"text":     "()[]{}\"\"",
+	"html":     "()[]{}\"\"''<>",
+	"xml":      "()[]{}\"\"''<>",
+	"vim":      "()[]{}''",
+}
+
+// Pairs returns the auto-pairs for the buffer, set by the autopairs option
+// or else those of its file type
+func (b *Buffer) Pairs() [][2]rune {
+	str := b.StringOption("autopairs")
+	if str == "auto" {
+		var ok bool
+		if str, ok = autoPairs[b.FileType]; !ok {
+			str = autoPairs["default"]
+		}
+	}
+	runes := []rune(str)
+	pairs := make([][2]rune, 0, len(runes)/2)
+	for i := 0; i+1 < len(runes); i += 2 {
+		pairs = append(pairs, [2]rune{runes[i], runes[i+1]})
+	}
+	return pairs
+}
+
+// closerFor returns the closing rune for the given opening rune
+func (b *Buffer) closerFor(r rune) (rune, bool) {
+	for _, p := range b.Pairs() {
+		if p[0] == r {
+			return p[1], true
+		}
+	}
+	return 0, false
+}
+
+// IsEmptyPair returns whether the given location sits between an opening
+// rune and its closing rune, as in (|)
+func (b *Buffer) IsEmptyPair(loc Loc) bool {
+	line := []rune(b.Line(loc.Y))
+	if loc.X <= 0 || loc.X >= len(line) {
+		return false
+	}
+	closer, ok := b.closerFor(line[loc.X-1])
+	return ok && closer == line[loc.X]
+}
+
+// shiftAutoClose updates the pending auto-inserted closers on line y after
+// n runes were inserted at column x. A negative n means -n runes were removed
+// starting at column x, which drops the closers that were removed with them
+func (v *View) shiftAutoClose(y, x, n int) {
+	locs := v.autoClose[:0]
+	for _, loc := range v.autoClose {
+		if loc.Y == y && loc.X >= x {
+			if n < 0 && loc.X < x-n {
+				continue
+			}
+			loc.X += n
+		}
+		locs = append(locs, loc)
+	}
+	v.autoClose = locs
+}
+
+// pendingCloser returns the index in v.autoClose of an auto-inserted closer r
+// under the cursor, or -1 if there is none
+func (v *View) pendingCloser(r rune) int {
+	for i := len(v.autoClose) - 1; i >= 0; i-- {
+		if v.autoClose[i] == v.Cursor.Loc && v.Cursor.RuneUnder(v.Cursor.X) == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// autoPair handles the typing of rune r with regard to auto-pairing.
+// It returns false if r should be inserted the normal way
+func (v *View) autoPair(r rune) bool {
+	// Step over an auto-inserted closer
+	if i := v.pendingCloser(r); i >= 0 {
+		v.autoClose = append(v.autoClose[:i], v.autoClose[i+1:]...)
+		v.Cursor.Right()
+		return true
+	}
+
+	closer, ok := v.Buf.closerFor(r)
+	if !ok {
+		return false
+	}
+
+	if v.Cursor.HasSelection() {
+		// Wrap the selection in the pair
+		start, end := v.Cursor.CurSelection[0], v.Cursor.CurSelection[1]
+		if start.GreaterThan(end) {
+			start, end = end, start
+		}
+		sel := v.Cursor.GetSelection()
+		v.Buf.Replace(start, end, string(r)+sel+string(closer))
+		start = start.Move(1, v.Buf)
+		v.Cursor.SetSelectionStart(start)
+		v.Cursor.SetSelectionEnd(start.Move(Count(sel), v.Buf))
+		v.Cursor.OrigSelection = v.Cursor.CurSelection
+		v.Cursor.Loc = v.Cursor.CurSelection[1]
+		return true
+	}
+
+	// Quotes are not paired directly after a word character, so that
+	// apostrophes in words such as don't are left alone
+	if r == closer && v.Cursor.X > 0 && IsWordChar(string(v.Cursor.RuneUnder(v.Cursor.X-1))) {
+		return false
+	}
+
+	v.shiftAutoClose(v.Cursor.Y, v.Cursor.X, 2)
+	v.Buf.Insert(v.Cursor.Loc, string(r)+string(closer))
+	v.Cursor.Right()
+	v.autoClose = append(v.autoClose, v.Cursor.Loc)
+	return true
+}
@@ -1,12 +1,59 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/dgv/zed/tcell"
 )
 
-var bindings map[Key][]func(*View) bool
+// A bindingNode is a node of the trie of bound key sequences. Typing the keys
+// that lead to a node runs its actions, unless more keys can follow them.
+// Then the node waits for the next key, and runs its actions if the sequence
+// is not continued
+type bindingNode struct {
+	actions  []func(*View) bool
+	names    string
+	children map[Key]*bindingNode
+}
+
+func newBindingNode() *bindingNode {
+	return &bindingNode{children: make(map[Key]*bindingNode)}
+}
+
+// The root of the trie of key bindings
+var bindings *bindingNode
+
+var (
+	// The keys of the sequence typed so far, and the node they lead to
+	pendingKeys []Key
+	pendingNode *bindingNode
+
+	// Counts the sequences started, so a timeout knows whether its
+	// sequence is still pending
+	pendingSeq int
+
+	// How many of the keys typed last led to the actions running, which
+	// StopRecordMacro leaves out of the macro
+	actionKeys int
+)
+
+// keyTimeoutEvent is sent when a pending key sequence times out
+type keyTimeoutEvent struct {
+	when time.Time
+	seq  int
+}
+
+func (e *keyTimeoutEvent) When() time.Time {
+	return e.when
+}
 
 var bindingActions = map[string]func(*View) bool{
 	"CursorUp":            (*View).CursorUp,
@@ -35,6 +82,7 @@ var bindingActions = map[string]func(*View) bool{
 	"Save":                (*View).Save,
 	"SaveAs":              (*View).SaveAs,
 	"Find":                (*View).Find,
+	"FindBackward":        (*View).FindBackward,
 	"FindNext":            (*View).FindNext,
 	"FindPrevious":        (*View).FindPrevious,
 	"Replace":             (*View).Replace,
@@ -44,6 +92,8 @@ var bindingActions = map[string]func(*View) bool{
 	"Copy":                (*View).Copy,
 	"Cut":                 (*View).Cut,
 	"CutLine":             (*View).CutLine,
+	"KillLine":            (*View).KillLine,
+	"KillRegion":          (*View).KillRegion,
 	"DuplicateLine":       (*View).DuplicateLine,
 	"DeleteLine":          (*View).DeleteLine,
 	"Paste":               (*View).Paste,
@@ -60,6 +110,76 @@ var bindingActions = map[string]func(*View) bool{
 	"Quit":                (*View).Quit,
 	"Suspend":             (*View).Suspend,
 
+	"JumpToMatchingBrace":   (*View).JumpToMatchingBrace,
+	"SelectToMatchingBrace": (*View).SelectToMatchingBrace,
+	"ToggleComment":         (*View).ToggleComment,
+	"IndentSelection":       (*View).IndentSelection,
+	"OutdentSelection":      (*View).OutdentSelection,
+	"MoveLinesUp":           (*View).MoveLinesUp,
+	"MoveLinesDown":         (*View).MoveLinesDown,
+
+	"Transform":        (*View).Transform,
+	"UpperCase":        (*View).UpperCase,
+	"LowerCase":        (*View).LowerCase,
+	"TitleCase":        (*View).TitleCase,
+	"SnakeCase":        (*View).SnakeCase,
+	"CamelCase":        (*View).CamelCase,
+	"KebabCase":        (*View).KebabCase,
+	"SortLines":        (*View).SortLines,
+	"SortLinesNumeric": (*View).SortLinesNumeric,
+	"SortLinesReverse": (*View).SortLinesReverse,
+	"SortLinesUnique":  (*View).SortLinesUnique,
+	"ReverseLines":     (*View).ReverseLines,
+	"ShuffleLines":     (*View).ShuffleLines,
+	"Base64Encode":     (*View).Base64Encode,
+	"Base64Decode":     (*View).Base64Decode,
+	"URLEncode":        (*View).URLEncode,
+	"URLDecode":        (*View).URLDecode,
+	"JSONPrettyPrint":  (*View).JSONPrettyPrint,
+	"JSONMinify":       (*View).JSONMinify,
+	"JSONValidate":     (*View).JSONValidate,
+
+	"StartRecordMacro": (*View).StartRecordMacro,
+	"StopRecordMacro":  (*View).StopRecordMacro,
+	"PlayMacro":        (*View).PlayMacro,
+
+	"PasteFromHistory":  (*View).PasteFromHistory,
+	"YankToRegister":    (*View).YankToRegister,
+	"PasteFromRegister": (*View).PasteFromRegister,
+	"Autocomplete":      (*View).Autocomplete,
+
+	"ExpandSnippet":       (*View).ExpandSnippet,
+	"NextSnippetStop":     (*View).NextSnippetStop,
+	"PreviousSnippetStop": (*View).PreviousSnippetStop,
+
+	"ReflowParagraph": (*View).ReflowParagraph,
+	"ToggleSoftWrap":  (*View).ToggleSoftWrap,
+
+	"Fold":       (*View).Fold,
+	"Unfold":     (*View).Unfold,
+	"ToggleFold": (*View).ToggleFold,
+	"FoldAll":    (*View).FoldAll,
+	"UnfoldAll":  (*View).UnfoldAll,
+
+	"ToggleBookmark":   (*View).ToggleBookmark,
+	"NextBookmark":     (*View).NextBookmark,
+	"PreviousBookmark": (*View).PreviousBookmark,
+	"ListBookmarks":    (*View).ListBookmarks,
+	"SetMark":          (*View).SetMark,
+	"JumpToMark":       (*View).JumpToMark,
+	"JumpBack":         (*View).JumpBack,
+	"JumpForward":      (*View).JumpForward,
+
+	"FilterThroughCommand": (*View).FilterThroughCommand,
+	"RunCommand":           (*View).RunCommand,
+	"KillCommand":          (*View).KillCommand,
+	"ToggleTerminal":       (*View).ToggleTerminal,
+	"TerminalToBuffer":     (*View).TerminalToBuffer,
+
+	"Set":      (*View).Set,
+	"SetLocal": (*View).SetLocal,
+	"Show":     (*View).Show,
+
 	// This was changed to InsertNewline but I don't want to break backwards compatibility
 	"InsertEnter": (*View).InsertNewline,
 }
@@ -201,11 +321,92 @@ type Key struct {
 	r         rune
 }
 
+// String returns the name of the key as it is written in bindings
+func (k Key) String() string {
+	name := string(k.r)
+	if k.keyCode != tcell.KeyRune {
+		// Several names can stand for the same key code. Prefer one that
+		// agrees with the Ctrl modifier, then the shortest
+		ctrl := k.modifiers&tcell.ModCtrl != 0
+		name = ""
+		for n, code := range bindingKeys {
+			if code != k.keyCode {
+				continue
+			}
+			better := strings.HasPrefix(n, "Ctrl") == ctrl
+			if name != "" && strings.HasPrefix(name, "Ctrl") == ctrl {
+				better = better && (len(n) < len(name) || len(n) == len(name) && n < name)
+			}
+			if name == "" || better {
+				name = n
+			}
+		}
+	}
+
+	var mods string
+	if k.modifiers&tcell.ModCtrl != 0 && !strings.HasPrefix(name, "Ctrl") {
+		mods += "Ctrl"
+	}
+	if k.modifiers&tcell.ModAlt != 0 {
+		mods += "Alt"
+	}
+	if k.modifiers&tcell.ModShift != 0 {
+		mods += "Shift"
+	}
+	return mods + name
+}
+
+// keyOf returns the binding Key a key event matches
+func keyOf(e *tcell.EventKey) Key {
+	k := Key{keyCode: e.Key(), modifiers: e.Modifiers()}
+	if e.Key() == tcell.KeyRune {
+		k.r = e.Rune()
+	}
+	return k
+}
+
 // InitBindings initializes the keybindings for micro
 func InitBindings() {
-	bindings = make(map[Key][]func(*View) bool)
-	defaults := DefaultBindings()
-	parseBindings(defaults)
+	if errs := loadBindings(); len(errs) > 0 {
+		TermMessage(strings.Join(errs, "\n"))
+	}
+}
+
+// bindingsFile returns the path of the user's key bindings
+func bindingsFile() string {
+	return filepath.Join(ConfigDir(), "bindings.json")
+}
+
+// loadBindings binds the keys of the keymap, then the ones in bindings.json
+// on top of them. It returns a message for every binding that is invalid
+func loadBindings() []string {
+	bindings = newBindingNode()
+	cancelPendingKeys()
+
+	var errs []string
+	switch StringOption("keymap") {
+	case "emacs":
+		parseBindings(EmacsBindings())
+	case "default", "vi":
+		// The vi keymap sits in front of the default bindings, which are used
+		// in insert mode
+		parseBindings(DefaultBindings())
+	default:
+		errs = append(errs, "unknown keymap: "+StringOption("keymap"))
+		parseBindings(DefaultBindings())
+	}
+
+	path := bindingsFile()
+	entries, fileErrs := readBindingsFile(path)
+	for _, err := range fileErrs {
+		errs = append(errs, err.Error())
+	}
+	for _, e := range entries {
+		if err := bindKey(e.key, e.actions); err != nil {
+			errs = append(errs, fmt.Sprintf("%s:%d:%d: %v", path, e.line, e.col, err))
+		}
+	}
+	return errs
 }
 
 func parseBindings(userBindings map[string]string) {
@@ -214,6 +415,134 @@ func parseBindings(userBindings map[string]string) {
 	}
 }
 
+// bindingEntry is a binding read from bindings.json, with the line and
+// column its key is at
+type bindingEntry struct {
+	key, actions string
+	line, col    int
+}
+
+// lineCol returns the line and column of the byte at offset in data
+func lineCol(data []byte, offset int64) (int, int) {
+	before := data[:offset]
+	line := bytes.Count(before, []byte{'\n'}) + 1
+	col := Count(string(before[bytes.LastIndexByte(before, '\n')+1:])) + 1
+	return line, col
+}
+
+// readBindingsFile reads the bindings in the file at path, in the order they
+// are written. A missing file has no bindings. Entries that can't be read are
+// skipped, with an error for each, and the rest of the file is still read
+func readBindingsFile(path string) ([]bindingEntry, []error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, []error{err}
+	}
+
+	errorAt := func(offset int64, format string, args ...interface{}) error {
+		line, col := lineCol(data, offset)
+		return fmt.Errorf("%s:%d:%d: %s", path, line, col, fmt.Sprintf(format, args...))
+	}
+	// skipSpace returns the offset of the next token after offset
+	skipSpace := func(offset int64) int64 {
+		for offset < int64(len(data)) && strings.ContainsRune(" \t\r\n,:", rune(data[offset])) {
+			offset++
+		}
+		return offset
+	}
+	// A decoder can't go on after a syntax error, so a new one is started
+	// after it. base is the offset in data of what the decoder reads first,
+	// and from the offset it started reading the file at
+	var base, from int64
+	dec := json.NewDecoder(bytes.NewReader(data))
+	token := func() (json.Token, int64, error) {
+		offset := skipSpace(base + dec.InputOffset())
+		t, err := dec.Token()
+		if err != nil {
+			if serr, ok := err.(*json.SyntaxError); ok && serr.Offset > 0 && base+serr.Offset <= int64(len(data)) {
+				// The offset is just after the character that is wrong
+				offset = base + serr.Offset - 1
+			}
+			return nil, offset, err
+		}
+		return t, offset, nil
+	}
+	// resume starts a new decoder for the entries after a syntax error at
+	// offset, on the same line if the error is where the line starts and on
+	// the next one otherwise. It reports whether anything is left to read
+	resume := func(offset int64) bool {
+		start := int64(bytes.LastIndexByte(data[:offset], '\n') + 1)
+		if start <= from || len(bytes.TrimSpace(data[start:offset])) > 0 {
+			start = int64(len(data))
+			if i := bytes.IndexByte(data[offset:], '\n'); i >= 0 {
+				start = offset + int64(i) + 1
+			}
+		}
+		if skipSpace(start) >= int64(len(data)) {
+			return false
+		}
+		// The rest of the file is read as the rest of the object
+		base, from = start-1, start
+		dec = json.NewDecoder(io.MultiReader(strings.NewReader("{"), bytes.NewReader(data[start:])))
+		dec.Token()
+		return true
+	}
+
+	t, offset, err := token()
+	if err != nil {
+		return nil, []error{errorAt(offset, "%v", err)}
+	}
+	if t != json.Delim('{') {
+		return nil, []error{errorAt(offset, "bindings must be an object of keys and actions")}
+	}
+	var entries []bindingEntry
+	var errs []error
+	for dec.More() {
+		t, keyOffset, err := token()
+		if err != nil {
+			errs = append(errs, errorAt(keyOffset, "%v", err))
+			if !resume(keyOffset) {
+				break
+			}
+			continue
+		}
+		key := t.(string)
+		t, offset, err = token()
+		if err == nil {
+			if actions, ok := t.(string); ok {
+				line, col := lineCol(data, keyOffset)
+				entries = append(entries, bindingEntry{key, actions, line, col})
+				continue
+			}
+			errs = append(errs, errorAt(offset, "the actions bound to %q must be a string", key))
+			// Skip the whole value if it is an object or an array
+			depth := 0
+			for err == nil {
+				switch t {
+				case json.Delim('{'), json.Delim('['):
+					depth++
+				case json.Delim('}'), json.Delim(']'):
+					depth--
+				}
+				if depth == 0 {
+					break
+				}
+				t, offset, err = token()
+			}
+		}
+		if err != nil {
+			errs = append(errs, errorAt(offset, "%v", err))
+			if !resume(offset) {
+				break
+			}
+		}
+	}
+	return entries, errs
+}
+
 // findKey will find binding Key 'b' using string 'k'
 func findKey(k string) (b Key, ok bool) {
 	modifiers := tcell.ModNone
@@ -284,31 +613,237 @@ func findAction(v string) (action func(*View) bool) {
 	return action
 }
 
-// BindKey takes a key and an action and binds the two together
-func BindKey(k, v string) {
-	key, ok := findKey(k)
+// firstApplying returns an action that runs actions in order until one of
+// them applies, which it tells by returning true
+func firstApplying(actions []func(*View) bool) func(*View) bool {
+	if len(actions) == 1 {
+		return actions[0]
+	}
+	return func(v *View) bool {
+		for _, action := range actions {
+			if action(v) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// bind binds actions to the sequence of keys below the node. names are the
+// names of the actions as they are written in bindings
+func (n *bindingNode) bind(keys []Key, actions []func(*View) bool, names string) {
+	for _, k := range keys {
+		child, ok := n.children[k]
+		if !ok {
+			child = newBindingNode()
+			n.children[k] = child
+		}
+		n = child
+	}
+	n.actions = actions
+	n.names = names
+}
+
+// lookup returns the actions bound to key k below the node
+func (n *bindingNode) lookup(k Key) []func(*View) bool {
+	if child, ok := n.children[k]; ok {
+		return child.actions
+	}
+	return nil
+}
+
+// unbind removes the binding of the sequence of keys below the node, and the
+// nodes that are left leading nowhere
+func (n *bindingNode) unbind(keys []Key) {
+	if len(keys) == 0 {
+		n.actions = nil
+		n.names = ""
+		return
+	}
+	child, ok := n.children[keys[0]]
 	if !ok {
-		TermMessage("Unknown keybinding: " + k)
 		return
 	}
+	child.unbind(keys[1:])
+	if len(child.actions) == 0 && len(child.children) == 0 {
+		delete(n.children, keys[0])
+	}
+}
 
-	actionNames := strings.Split(v, ",")
-	if actionNames[0] == "UnbindKey" {
-		delete(bindings, key)
-		if len(actionNames) == 1 {
-			return
+// BindKey takes a key and an action and binds the two together. The key may
+// be a sequence of keys separated by spaces, such as "CtrlK CtrlC". Actions
+// separated by commas all run, while of actions separated by | only the
+// first one that applies does, such as "IndentSelection|InsertTab"
+func BindKey(k, v string) {
+	if err := bindKey(k, v); err != nil {
+		TermMessage(err)
+	}
+}
+
+// bindKey is like BindKey but returns an error if the key or one of the
+// actions is unknown, in which case nothing is bound
+func bindKey(k, v string) error {
+	names := strings.Fields(k)
+	if len(names) == 0 {
+		return fmt.Errorf("unknown key %q", k)
+	}
+	keys := make([]Key, len(names))
+	for i, name := range names {
+		key, ok := findKey(name)
+		if !ok {
+			return fmt.Errorf("unknown key %q", name)
 		}
-		actionNames = append(actionNames[:0], actionNames[1:]...)
+		keys[i] = key
+	}
+
+	actionNames := strings.Split(v, ",")
+	unbind := actionNames[0] == "UnbindKey"
+	if unbind {
+		actionNames = actionNames[1:]
 	}
 	actions := make([]func(*View) bool, 0, len(actionNames))
-	for _, actionName := range actionNames {
-		actions = append(actions, findAction(actionName))
+	for i, actionName := range actionNames {
+		// Actions separated by | are alternatives, each tried only if the
+		// ones before it didn't apply
+		alternatives := strings.Split(actionName, "|")
+		group := make([]func(*View) bool, len(alternatives))
+		for j, name := range alternatives {
+			name = strings.TrimSpace(name)
+			if group[j] = findAction(name); group[j] == nil {
+				return fmt.Errorf("unknown action %q", name)
+			}
+			alternatives[j] = name
+		}
+		actions = append(actions, firstApplying(group))
+		actionNames[i] = strings.Join(alternatives, "|")
 	}
 
+	if unbind {
+		bindings.unbind(keys)
+	}
 	if len(actions) > 0 {
 		// Can't have a binding be both mouse and normal
-		bindings[key] = actions
+		bindings.bind(keys, actions, strings.Join(actionNames, ","))
+	}
+	return nil
+}
+
+// DumpBindings returns the bindings in effect in the form of bindings.json
+func DumpBindings() map[string]string {
+	dump := make(map[string]string)
+	var walk func(n *bindingNode, keys []string)
+	walk = func(n *bindingNode, keys []string) {
+		if len(n.actions) > 0 {
+			dump[strings.Join(keys, " ")] = n.names
+		}
+		for k, child := range n.children {
+			walk(child, append(keys[:len(keys):len(keys)], k.String()))
+		}
 	}
+	walk(bindings, nil)
+	return dump
+}
+
+func init() {
+	// ReloadBindings rebinds keys, so listing it in bindingActions directly
+	// would make bindingActions refer to itself
+	bindingActions["ReloadBindings"] = (*View).ReloadBindings
+}
+
+// ReloadBindings reads bindings.json again and rebinds the keys
+func (v *View) ReloadBindings() bool {
+	if errs := loadBindings(); len(errs) > 0 {
+		messenger.Alert(strings.Join(errs, "; "))
+	}
+
+	return false
+}
+
+// cancelPendingKeys forgets the key sequence typed so far
+func cancelPendingKeys() {
+	pendingKeys = nil
+	pendingNode = nil
+}
+
+// pendingKeysString returns the key sequence typed so far as it is shown in
+// the status line
+func pendingKeysString() string {
+	names := make([]string, len(pendingKeys))
+	for i, k := range pendingKeys {
+		names[i] = k.String()
+	}
+	return strings.Join(names, " ") + "-"
+}
+
+// startKeyTimeout sends a keyTimeoutEvent for the pending sequence once
+// -keytimeout has passed
+func startKeyTimeout() {
+	pendingSeq++
+	timeout := IntOption("keytimeout")
+	if timeout <= 0 || events == nil {
+		return
+	}
+	seq := pendingSeq
+	time.AfterFunc(time.Duration(timeout)*time.Millisecond, func() {
+		events <- &keyTimeoutEvent{time.Now(), seq}
+	})
+}
+
+// handleBindingKey runs the binding a key event completes. It returns whether
+// the key was taken by a binding, and whether the view should be relocated
+func (v *View) handleBindingKey(e *tcell.EventKey) (bool, bool) {
+	k := keyOf(e)
+	if pendingNode != nil {
+		node := pendingNode
+		next, ok := node.children[k]
+		if !ok {
+			// The key doesn't continue the sequence. Escape cancels it,
+			// otherwise the sequence typed so far runs and the key is
+			// handled on its own
+			// The key is counted too, as it comes after the actions
+			keys := len(pendingKeys) + 1
+			cancelPendingKeys()
+			if e.Key() == tcell.KeyEscape || len(node.actions) == 0 {
+				return true, false
+			}
+			actionKeys = keys
+			relocate := v.ExecuteActions(node.actions)
+			isBinding, relocateKey := v.handleBindingKey(e)
+			return isBinding, relocate || relocateKey
+		}
+		return v.enterBindingNode(k, next)
+	}
+
+	next, ok := bindings.children[k]
+	if !ok {
+		return false, true
+	}
+	return v.enterBindingNode(k, next)
+}
+
+// enterBindingNode runs the actions of the node reached by key k, or waits
+// for the next key if the sequence can go on
+func (v *View) enterBindingNode(k Key, node *bindingNode) (bool, bool) {
+	if len(node.children) > 0 {
+		pendingKeys = append(pendingKeys, k)
+		pendingNode = node
+		startKeyTimeout()
+		return true, false
+	}
+	actionKeys = len(pendingKeys) + 1
+	cancelPendingKeys()
+	return true, v.ExecuteActions(node.actions)
+}
+
+// keyTimeout runs the pending key sequence if it is the one that timed out
+func (v *View) keyTimeout(e *keyTimeoutEvent) bool {
+	if pendingNode == nil || e.seq != pendingSeq {
+		return false
+	}
+	node := pendingNode
+	actionKeys = len(pendingKeys)
+	cancelPendingKeys()
+	return len(node.actions) > 0 && v.ExecuteActions(node.actions)
 }
 
 // DefaultBindings returns a map containing micro's default keybindings
@@ -331,7 +866,8 @@ func DefaultBindings() map[string]string {
 		"Enter":          "InsertNewline",
 		"CtrlR":          "Replace",
 		"Backspace":      "Backspace",
-		"Tab":            "InsertTab",
+		"Tab":            "NextSnippetStop|ExpandSnippet|IndentSelection|InsertTab",
+		"Backtab":        "PreviousSnippetStop|OutdentSelection",
 		"CtrlO":          "OpenFile",
 		"CtrlS":          "Save",
 		"CtrlF":          "Find",
@@ -352,5 +888,103 @@ func DefaultBindings() map[string]string {
 		"PageUp":         "CursorPageUp",
 		"PageDown":       "CursorPageDown",
 		"Delete":         "Delete",
+		"CtrlB":          "JumpToMatchingBrace",
+		"CtrlUnderscore": "ToggleComment",
+		"AltUp":          "MoveLinesUp",
+		"AltDown":        "MoveLinesDown",
+		"CtrlT":          "Transform",
+		"F3":             "StartRecordMacro",
+		"F4":             "StopRecordMacro",
+		"F5":             "PlayMacro",
+		"Altv":           "PasteFromHistory",
+		"CtrlSpace":      "Autocomplete",
+		"Altq":           "ReflowParagraph",
+		"Altz":           "ToggleSoftWrap",
+		"Alt[":           "Fold",
+		"Alt]":           "Unfold",
+		"Alt{":           "FoldAll",
+		"Alt}":           "UnfoldAll",
+		"Alt.":           "ToggleFold",
+		"F2":             "ToggleBookmark",
+		"CtrlF2":         "NextBookmark",
+		"ShiftF2":        "PreviousBookmark",
+		"AltF2":          "ListBookmarks",
+		"Altm":           "SetMark",
+		"Altj":           "JumpToMark",
+		"AltPageUp":      "JumpBack",
+		"AltPageDown":    "JumpForward",
+		"Alt=":           "Set",
+		"CtrlE":          "CommandMode",
+		"Alt|":           "FilterThroughCommand",
+		"Alt!":           "RunCommand",
+		"AltK":           "KillCommand",
+		"Alt`":           "ToggleTerminal",
+	}
+}
+
+// EmacsBindings returns a map containing the keybindings of the emacs keymap
+func EmacsBindings() map[string]string {
+	return map[string]string{
+		"Up":             "CursorUp",
+		"Down":           "CursorDown",
+		"Right":          "CursorRight",
+		"Left":           "CursorLeft",
+		"ShiftUp":        "SelectUp",
+		"ShiftDown":      "SelectDown",
+		"ShiftLeft":      "SelectLeft",
+		"ShiftRight":     "SelectRight",
+		"ShiftHome":      "SelectToStartOfLine",
+		"ShiftEnd":       "SelectToEndOfLine",
+		"Enter":          "InsertNewline",
+		"Backspace":      "Backspace",
+		"Tab":            "NextSnippetStop|ExpandSnippet|IndentSelection|InsertTab",
+		"Backtab":        "PreviousSnippetStop|OutdentSelection",
+		"Home":           "StartOfLine",
+		"End":            "EndOfLine",
+		"PageUp":         "CursorPageUp",
+		"PageDown":       "CursorPageDown",
+		"Delete":         "Delete",
+		"CtrlF":          "CursorRight",
+		"CtrlB":          "CursorLeft",
+		"CtrlN":          "CursorDown",
+		"CtrlP":          "CursorUp",
+		"CtrlA":          "StartOfLine",
+		"CtrlE":          "EndOfLine",
+		"Altf":           "WordRight",
+		"Altb":           "WordLeft",
+		"CtrlV":          "CursorPageDown",
+		"Altv":           "CursorPageUp",
+		"Alt<":           "CursorStart",
+		"Alt>":           "CursorEnd",
+		"CtrlL":          "Center",
+		"CtrlD":          "Delete",
+		"CtrlK":          "KillLine",
+		"CtrlW":          "KillRegion",
+		"Altw":           "Copy",
+		"CtrlY":          "Paste",
+		"Alty":           "PasteFromHistory",
+		"CtrlS":          "Find",
+		"CtrlR":          "FindBackward",
+		"Alt%":           "Replace",
+		"CtrlG":          "Escape",
+		"CtrlUnderscore": "Undo",
+		"Alt_":           "Redo",
+		"Alt;":           "ToggleComment",
+		"Alt/":           "Autocomplete",
+		"Altq":           "ReflowParagraph",
+		"CtrlZ":          "Suspend",
+		"Altg g":         "GotoLine",
+		"Altx":           "CommandMode",
+		"Alt|":           "FilterThroughCommand",
+		"Alt`":           "ToggleTerminal",
+		"CtrlX CtrlS":    "Save",
+		"CtrlX CtrlW":    "SaveAs",
+		"CtrlX CtrlF":    "OpenFile",
+		"CtrlX CtrlC":    "Quit",
+		"CtrlX u":        "Undo",
+		"CtrlX h":        "SelectAll",
+		"CtrlX (":        "StartRecordMacro",
+		"CtrlX )":        "StopRecordMacro",
+		"CtrlX e":        "PlayMacro",
 	}
 }
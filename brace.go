@@ -0,0 +1,142 @@
+package main
+
+// braceMatchWindow is the number of lines above and below the viewport that
+// are scanned when looking for a matching brace
+const braceMatchWindow = 500
+
+var bracePairs = [][2]rune{{'(', ')'}, {'[', ']'}, {'{', '}'}}
+
+// braceUnderCursor returns the location of the brace under the cursor or,
+// failing that, the one just before it. under tells which of the two it is
+func (v *View) braceUnderCursor() (loc Loc, under bool, ok bool) {
+	for _, x := range []int{v.Cursor.X, v.Cursor.X - 1} {
+		if x < 0 {
+			continue
+		}
+		r := v.Cursor.RuneUnder(x)
+		for _, bp := range bracePairs {
+			if r == bp[0] || r == bp[1] {
+				return Loc{x, v.Cursor.Y}, x == v.Cursor.X, true
+			}
+		}
+	}
+	return Loc{}, false, false
+}
+
+// FindMatchingBrace returns the location of the brace matching the one at loc.
+// Braces inside strings and comments are skipped, and the search gives up
+// outside of a window around the viewport
+func (v *View) FindMatchingBrace(loc Loc) (Loc, bool) {
+	first := Max(0, v.Topline-braceMatchWindow)
+	last := Min(v.Buf.NumLines, v.Topline+v.Height+braceMatchWindow)
+	if loc.Y < first || loc.Y >= last {
+		return Loc{}, false
+	}
+	mask := v.Buf.codeMask(first, last)
+	line := []rune(v.Buf.Line(loc.Y))
+	if loc.X >= len(line) || !mask[loc.Y-first][loc.X] {
+		return Loc{}, false
+	}
+
+	r := line[loc.X]
+	for _, bp := range bracePairs {
+		var target rune
+		dir := 1
+		switch r {
+		case bp[0]:
+			target = bp[1]
+		case bp[1]:
+			target = bp[0]
+			dir = -1
+		default:
+			continue
+		}
+
+		depth := 0
+		x, y := loc.X, loc.Y
+		for {
+			for x >= 0 && x < len(line) {
+				if mask[y-first][x] {
+					switch line[x] {
+					case r:
+						depth++
+					case target:
+						depth--
+					}
+					if depth == 0 {
+						return Loc{x, y}, true
+					}
+				}
+				x += dir
+			}
+			y += dir
+			if y < first || y >= last {
+				return Loc{}, false
+			}
+			line = []rune(v.Buf.Line(y))
+			if dir > 0 {
+				x = 0
+			} else {
+				x = len(line) - 1
+			}
+		}
+	}
+	return Loc{}, false
+}
+
+// matchingBrace returns the location of the brace matching the one under or
+// before the cursor, if any
+func (v *View) matchingBrace() (Loc, bool) {
+	loc, _, ok := v.braceUnderCursor()
+	if !ok {
+		return Loc{}, false
+	}
+	return v.FindMatchingBrace(loc)
+}
+
+// JumpToMatchingBrace moves the cursor to the brace matching the one under
+// or before the cursor
+func (v *View) JumpToMatchingBrace() bool {
+	loc, under, ok := v.braceUnderCursor()
+	if !ok {
+		return false
+	}
+	match, ok := v.FindMatchingBrace(loc)
+	if !ok {
+		return false
+	}
+
+	v.deselect(0)
+	if under {
+		v.Cursor.Loc = match
+	} else {
+		v.Cursor.Loc = Loc{match.X + 1, match.Y}
+	}
+	v.Cursor.LastVisualX = v.Cursor.GetVisualX()
+
+	return true
+}
+
+// SelectToMatchingBrace selects the text between the brace under or before
+// the cursor and its match, braces included
+func (v *View) SelectToMatchingBrace() bool {
+	loc, _, ok := v.braceUnderCursor()
+	if !ok {
+		return false
+	}
+	match, ok := v.FindMatchingBrace(loc)
+	if !ok {
+		return false
+	}
+
+	start, end := loc, match
+	if start.GreaterThan(end) {
+		start, end = end, start
+	}
+	v.Cursor.SetSelectionStart(start)
+	v.Cursor.SetSelectionEnd(Loc{end.X + 1, end.Y})
+	v.Cursor.OrigSelection = v.Cursor.CurSelection
+	v.Cursor.Loc = v.Cursor.CurSelection[1]
+
+	return true
+}
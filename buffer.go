@@ -1,12 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"io"
 	"io/ioutil"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -27,6 +29,24 @@ type Buffer struct {
 	AbsPath string
 	// Name of the buffer on the status line
 	name string
+	// The file type, used for language specific behaviour such as auto-pairing
+	FileType string
+
+	// The values of options set for this buffer only, with setlocal
+	Settings map[string]interface{}
+
+	// Read-only buffers can't be edited, only added to by zed itself
+	ReadOnly bool
+
+	// The words in the buffer, used for completion
+	words *WordIndex
+
+	// Locations that move along with the text as it changes
+	anchors []*Anchor
+
+	// The marks a-z and the bookmarked lines
+	marks     map[rune]*Anchor
+	bookmarks []*Anchor
 
 	// Whether or not the buffer has been modified since it was opened
 	IsModified bool
@@ -52,19 +72,33 @@ func NewBufferFromString(text, path string) *Buffer {
 // NewBuffer creates a new buffer from a given reader with a given path
 func NewBuffer(reader io.Reader, size int64, path string) *Buffer {
 	b := new(Buffer)
-	b.LineArray = NewLineArray(size, reader)
 
 	absPath, _ := filepath.Abs(path)
 
 	b.Path = path
 	b.AbsPath = absPath
+	b.FileType = DetectFileType(path)
+	b.applyEditorConfig()
+
+	// Files that aren't utf-8 with unix line endings are converted as a whole
+	if encoding, fileformat := b.StringOption("encoding"), b.StringOption("fileformat"); encoding != "utf-8" || fileformat != "unix" {
+		data, _ := ioutil.ReadAll(reader)
+		text := decodeText(data, encoding, fileformat)
+		reader, size = strings.NewReader(text), int64(len(text))
+	}
+	b.LineArray = NewLineArray(size, reader)
 
 	// The last time this file was modified
 	b.ModTime, _ = GetModTime(b.Path)
 
 	b.EventHandler = NewEventHandler(b)
+	b.words = NewWordIndex(b)
 
 	b.Update()
+	b.applyModelines()
+
+	b.marks = make(map[rune]*Anchor)
+	b.loadMarks()
 
 	// Put the cursor at the first spot
 	cursorStartX := 0
@@ -116,6 +150,9 @@ func (b *Buffer) GetName() string {
 
 // IndentString returns a string representing one level of indentation
 func (b *Buffer) IndentString() string {
+	if b.BoolOption("tabstospaces") {
+		return Spaces(b.IntOption("tabsize"))
+	}
 	return "\t"
 }
 
@@ -143,7 +180,7 @@ func (b *Buffer) CheckModTime() {
 // ReOpen reloads the current buffer from disk
 func (b *Buffer) ReOpen() {
 	data, err := ioutil.ReadFile(b.Path)
-	txt := string(data)
+	txt := decodeText(data, b.StringOption("encoding"), b.StringOption("fileformat"))
 
 	if err != nil {
 		messenger.Alert(err.Error())
@@ -171,35 +208,70 @@ func (b *Buffer) Save() error {
 func (b *Buffer) SaveAs(filename string) error {
 	//b.UpdateRules()
 	dir, _ := homedir.Dir()
-	str := b.String()
-	data := []byte(str)
+	if b.BoolOption("rmtrailingws") {
+		b.removeTrailingWhitespace()
+	}
+	if b.BoolOption("eofnewline") && b.Line(b.NumLines-1) != "" {
+		b.Insert(b.End(), "\n")
+	}
+	data, err := encodeText(b.String(), b.StringOption("encoding"), b.StringOption("fileformat"))
+	if err != nil {
+		return err
+	}
 	filename = strings.Replace(filename, "~", dir, 1)
-	err := ioutil.WriteFile(filename, data, 0644)
+	err = ioutil.WriteFile(filename, data, 0644)
 	if err == nil {
-		b.Path = strings.Replace(filename, "~", dir, 1)
+		// Keep the file type a modeline may have set unless the name changed
+		if filename != b.Path {
+			b.FileType = DetectFileType(filename)
+		}
+		b.Path = filename
 		b.IsModified = false
 		b.ModTime, _ = GetModTime(filename)
+		b.marksChanged()
 		return err
 	}
 	b.ModTime, _ = GetModTime(filename)
 	return err
 }
 
+// removeTrailingWhitespace removes the whitespace at the end of every line
+func (b *Buffer) removeTrailingWhitespace() {
+	var deltas []Delta
+	for y := 0; y < b.NumLines; y++ {
+		line := b.Line(y)
+		if trimmed := strings.TrimRightFunc(line, unicode.IsSpace); trimmed != line {
+			deltas = append(deltas, Delta{"", Loc{Count(trimmed), y}, Loc{Count(line), y}})
+		}
+	}
+	if len(deltas) > 0 {
+		b.MultipleReplace(deltas)
+		b.Cursor.Relocate()
+	}
+}
+
 func (b *Buffer) insert(pos Loc, value []byte) {
 	b.IsModified = true
 	b.LineArray.insert(pos, value)
 	b.Update()
+	b.words.inserted(b, pos.Y, bytes.Count(value, []byte{'\n'}))
+	b.anchorsInserted(pos, value)
 }
 func (b *Buffer) remove(start, end Loc) string {
 	b.IsModified = true
 	sub := b.LineArray.remove(start, end)
 	b.Update()
+	b.words.removed(b, start.Y, end.Y)
+	b.anchorsRemoved(start, end)
 	return sub
 }
 func (b *Buffer) deleteToEnd(start Loc) {
 	b.IsModified = true
+	end := Loc{Count(b.Line(start.Y)), start.Y}
 	b.LineArray.DeleteToEnd(start)
 	b.Update()
+	b.words.setLine(start.Y, b.Line(start.Y))
+	b.anchorsRemoved(start, end)
 }
 
 // Start returns the location of the first character in the buffer
@@ -53,20 +53,36 @@ type Char struct {
 	width    int
 }
 
+// cellRow tells which part of a line a row of the cell view shows
+type cellRow struct {
+	line  int
+	start int
+	// Whether the row continues the line from the row above
+	wrapped bool
+	// Whether the row shows the end of the line
+	last bool
+	// How many lines are folded under the line
+	folded int
+}
+
 type CellView struct {
 	lines [][]*Char
+	rows  []cellRow
 }
 
-func (c *CellView) Draw(buf *Buffer, top, height, left, width int) {
-	tabsize := *flagTabSize
-	indentrunes := []rune(" ")
-	// if empty indentchar settings, use space
-	if indentrunes == nil || len(indentrunes) == 0 {
-		indentrunes = []rune(" ")
+// Draw fills the cell view with the lines from top on. next returns the line
+// drawn after a line, which skips lines that are folded away
+func (c *CellView) Draw(buf *Buffer, top, height, left, width int, softwrap bool, next func(int) int) {
+	if softwrap {
+		c.drawWrapped(buf, top, height, width, next)
+		return
 	}
-	indentchar := indentrunes[0]
+
+	tabsize := buf.IntOption("tabsize")
+	indentchar := []rune(buf.StringOption("indentchar"))[0]
 
 	c.lines = make([][]*Char, 0)
+	c.rows = make([]cellRow, 0)
 
 	viewLine := 0
 	lineN := top
@@ -93,6 +109,7 @@ func (c *CellView) Draw(buf *Buffer, top, height, left, width int) {
 		// whichever is smaller
 		lineLength := min(StringWidth(lineStr, tabsize), width)
 		c.lines = append(c.lines, make([]*Char, lineLength))
+		c.rows = append(c.rows, cellRow{line: lineN, last: true, folded: next(lineN) - lineN - 1})
 
 		for viewCol < lineLength {
 			if colN >= len(line) {
@@ -143,7 +160,7 @@ func (c *CellView) Draw(buf *Buffer, top, height, left, width int) {
 
 		// newline
 		viewLine++
-		lineN++
+		lineN = next(lineN)
 	}
 
 	for i := top; i < top+height; i++ {
@@ -152,3 +169,55 @@ func (c *CellView) Draw(buf *Buffer, top, height, left, width int) {
 		}
 	}
 }
+
+// drawWrapped fills the cell view like Draw, but continues lines that are
+// wider than the view on the following rows instead of cutting them off
+func (c *CellView) drawWrapped(buf *Buffer, top, height, width int, next func(int) int) {
+	tabsize := buf.IntOption("tabsize")
+	indentchar := []rune(buf.StringOption("indentchar"))[0]
+
+	c.lines = make([][]*Char, 0)
+	c.rows = make([]cellRow, 0)
+
+	viewLine := 0
+	for lineN := top; viewLine < height && lineN < len(buf.lines); lineN = next(lineN) {
+		lineStr := buf.Line(lineN)
+		line := []rune(lineStr)
+		widths := lineWidths(lineStr, tabsize)
+		rows := wrapRows(lineStr, width, tabsize)
+
+		for r, start := range rows {
+			if viewLine >= height {
+				break
+			}
+			end := len(line)
+			if r < len(rows)-1 {
+				end = rows[r+1]
+			}
+
+			lineLength := min(widths[end]-widths[start], width)
+			cells := make([]*Char, lineLength)
+			viewCol := 0
+			for colN := start; colN < end && viewCol < lineLength; colN++ {
+				char := line[colN]
+				charWidth := widths[colN+1] - widths[colN]
+
+				cells[viewCol] = &Char{Loc{viewCol, viewLine}, Loc{colN, lineN}, char, char, defStyle, Max(charWidth, 1)}
+				if char == '\t' {
+					cells[viewCol].drawChar = indentchar
+				}
+				for i := 1; i < charWidth; i++ {
+					viewCol++
+					if viewCol < lineLength {
+						cells[viewCol] = &Char{Loc{viewCol, viewLine}, Loc{colN, lineN}, char, ' ', defStyle, 1}
+					}
+				}
+				viewCol++
+			}
+
+			c.lines = append(c.lines, cells)
+			c.rows = append(c.rows, cellRow{lineN, start, r > 0, r == len(rows)-1, next(lineN) - lineN - 1})
+			viewLine++
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/dgv/clipboard"
+)
+
+// ClipboardProvider reads and writes the clipboard
+type ClipboardProvider interface {
+	// Name is the name used to force the provider with -clipboard
+	Name() string
+	ReadAll() (string, error)
+	WriteAll(text string) error
+}
+
+// commandClipboard uses external programs such as xclip to access the clipboard
+type commandClipboard struct {
+	name  string
+	copy  []string
+	paste []string
+	// What the paste command prints when it fails because the clipboard is
+	// empty
+	empty []string
+}
+
+// errClipboardEmpty is returned when there is nothing on the clipboard
+var errClipboardEmpty = errors.New("the clipboard is empty")
+
+func (c *commandClipboard) Name() string {
+	return c.name
+}
+
+func (c *commandClipboard) ReadAll() (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(c.paste[0], c.paste[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		for _, msg := range c.empty {
+			if strings.Contains(stderr.String(), msg) {
+				return "", errClipboardEmpty
+			}
+		}
+		return "", commandError(err, &stderr)
+	}
+	return string(out), nil
+}
+
+func (c *commandClipboard) WriteAll(text string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(c.copy[0], c.copy[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return commandError(err, &stderr)
+	}
+	return nil
+}
+
+// commandError adds what a failed command printed to its error
+func commandError(err error, stderr *bytes.Buffer) error {
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return errors.New(msg)
+	}
+	return err
+}
+
+// osc52Clipboard writes the clipboard through the terminal with the OSC 52
+// escape sequence, which also works over ssh. Terminals don't let programs
+// read the clipboard this way, so reading returns the last text written
+type osc52Clipboard struct {
+	internalClipboard
+}
+
+func (c *osc52Clipboard) Name() string {
+	return "osc52"
+}
+
+func (c *osc52Clipboard) WriteAll(text string) error {
+	if screen == nil {
+		return errors.New("no terminal to send the clipboard to")
+	}
+	screen.SetClipboard([]byte(text))
+	return c.internalClipboard.WriteAll(text)
+}
+
+// systemClipboard uses the platform's native clipboard API
+type systemClipboard struct{}
+
+func (c *systemClipboard) Name() string {
+	return "system"
+}
+
+func (c *systemClipboard) ReadAll() (string, error) {
+	return clipboard.ReadAll()
+}
+
+func (c *systemClipboard) WriteAll(text string) error {
+	return clipboard.WriteAll(text)
+}
+
+// internalClipboard keeps the clipboard inside zed
+type internalClipboard struct {
+	text string
+}
+
+func (c *internalClipboard) Name() string {
+	return "internal"
+}
+
+func (c *internalClipboard) ReadAll() (string, error) {
+	return c.text, nil
+}
+
+func (c *internalClipboard) WriteAll(text string) error {
+	c.text = text
+	return nil
+}
+
+// clipboardProviders returns every provider zed knows about
+func clipboardProviders() []ClipboardProvider {
+	return []ClipboardProvider{
+		&commandClipboard{"wl-copy", []string{"wl-copy"}, []string{"wl-paste", "--no-newline"}, []string{"Nothing is copied", "No selection"}},
+		&commandClipboard{"xclip", []string{"xclip", "-in", "-selection", "clipboard"}, []string{"xclip", "-out", "-selection", "clipboard"}, []string{"not available"}},
+		&commandClipboard{"xsel", []string{"xsel", "--input", "--clipboard"}, []string{"xsel", "--output", "--clipboard"}, nil},
+		&commandClipboard{"pbcopy", []string{"pbcopy"}, []string{"pbpaste"}, nil},
+		&commandClipboard{"tmux", []string{"tmux", "load-buffer", "-"}, []string{"tmux", "save-buffer", "-"}, []string{"no buffers"}},
+		new(osc52Clipboard),
+		new(systemClipboard),
+		new(internalClipboard),
+	}
+}
+
+// findClipboard returns the provider with the given name
+func findClipboard(name string) (ClipboardProvider, bool) {
+	for _, p := range clipboardProviders() {
+		if p.Name() == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// hasCommand returns whether the given program is in the PATH
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// detectClipboard picks the provider best suited to the environment
+func detectClipboard() ClipboardProvider {
+	name := "internal"
+	switch {
+	case os.Getenv("WAYLAND_DISPLAY") != "" && hasCommand("wl-copy"):
+		name = "wl-copy"
+	case os.Getenv("DISPLAY") != "" && hasCommand("xclip"):
+		name = "xclip"
+	case os.Getenv("DISPLAY") != "" && hasCommand("xsel"):
+		name = "xsel"
+	case runtime.GOOS == "darwin" && os.Getenv("SSH_TTY") == "":
+		name = "pbcopy"
+	case runtime.GOOS == "windows":
+		name = "system"
+	case os.Getenv("TMUX") != "" && hasCommand("tmux"):
+		name = "tmux"
+	case os.Getenv("SSH_TTY") != "" || os.Getenv("SSH_CONNECTION") != "":
+		name = "osc52"
+	}
+	p, _ := findClipboard(name)
+	return p
+}
+
+// The clipboard provider in use, and the copy zed keeps in case it fails
+var (
+	clipboardProvider ClipboardProvider
+	clipboardFallback internalClipboard
+)
+
+// InitClipboard sets up the clipboard provider given by the clipboard
+// option, or detects one if it is auto
+func InitClipboard() {
+	if p, ok := findClipboard(StringOption("clipboard")); ok {
+		clipboardProvider = p
+		return
+	}
+	clipboardProvider = detectClipboard()
+}
+
+// WriteClipboard puts text on the clipboard and tells the user if that failed.
+// zed keeps its own copy of the text either way
+func WriteClipboard(text string) {
+	clipboardFallback.WriteAll(text)
+	if err := clipboardProvider.WriteAll(text); err != nil {
+		messenger.Alert("could not copy to the ", clipboardProvider.Name(), " clipboard, keeping it in zed only: ", err)
+	}
+}
+
+// ReadClipboard returns the text on the clipboard. If the clipboard is empty
+// zed's own copy is returned, and if it can't be read the user is told too
+func ReadClipboard() string {
+	text, err := clipboardProvider.ReadAll()
+	if err == errClipboardEmpty {
+		text, _ = clipboardFallback.ReadAll()
+	} else if err != nil {
+		messenger.Alert("could not paste from the ", clipboardProvider.Name(), " clipboard, using zed's copy: ", err)
+		text, _ = clipboardFallback.ReadAll()
+	}
+	return text
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Command is a command that can be typed into the command bar
+type Command struct {
+	// How to call the command, shown by help
+	Usage string
+	Help  string
+	// Run runs the command with the arguments typed after its name
+	Run func(v *View, args []string)
+	// Complete completes the last of the arguments typed so far
+	Complete Completer
+	// Raw commands get the rest of the line as it was typed, as a single
+	// argument, so shell commands keep their quoting
+	Raw bool
+}
+
+// commands holds the commands of the command bar by name, including one
+// for every action
+var commands map[string]Command
+
+func init() {
+	// The commands run actions and bind keys, so they are set up here to
+	// keep bindingActions from referring to itself
+	commands = map[string]Command{
+		"open": {
+			Usage:    "open file",
+			Help:     "opens a file in the view",
+			Run:      (*View).openCommand,
+			Complete: argCompleter(completeFile),
+		},
+		"save": {
+			Usage: "save",
+			Help:  "saves the buffer",
+			Run:   (*View).saveCommand,
+		},
+		"saveas": {
+			Usage:    "saveas file",
+			Help:     "saves the buffer to a file and switches to it",
+			Run:      (*View).saveAsCommand,
+			Complete: argCompleter(completeFile),
+		},
+		"quit": {
+			Usage: "quit",
+			Help:  "quits zed, asking to save changes first",
+			Run:   (*View).quitCommand,
+		},
+		"goto": {
+			Usage: "goto line[:col]",
+			Help:  "moves the cursor to a line, and a column in it",
+			Run:   (*View).gotoCommand,
+		},
+		"replace": {
+			Usage: "replace search replacement",
+			Help:  "replaces matches of the search regexp, asking about each",
+			Run:   (*View).replaceCommand,
+		},
+		"set": {
+			Usage:    "set [-save] option [value]",
+			Help:     "sets an option for every buffer, toggling bool options given no value",
+			Run:      func(v *View, args []string) { v.setCommand(args, false) },
+			Complete: completeSet,
+		},
+		"setlocal": {
+			Usage:    "setlocal [-save] option [value]",
+			Help:     "sets an option for the buffer, toggling bool options given no value",
+			Run:      func(v *View, args []string) { v.setCommand(args, true) },
+			Complete: completeSet,
+		},
+		"show": {
+			Usage:    "show [option]",
+			Help:     "shows the value of an option, or lists them all",
+			Run:      (*View).showCommand,
+			Complete: argCompleter(completeOption),
+		},
+		"bind": {
+			Usage:    "bind key action[,action...]",
+			Help:     "binds a key, or a sequence of keys separated by spaces, until zed quits",
+			Run:      (*View).bindCommand,
+			Complete: argCompleter(completeKey, completeAction),
+		},
+		"filter": {
+			Usage:    "filter command [args...]",
+			Help:     "replaces the selection, or the buffer, with the output of a shell command given it as input",
+			Run:      (*View).filterCommand,
+			Complete: completeFileArgs,
+			Raw:      true,
+		},
+		"run": {
+			Usage:    "run command [args...]",
+			Help:     "runs a shell command in the background, showing its output in a new buffer",
+			Run:      (*View).runCommand,
+			Complete: completeFileArgs,
+			Raw:      true,
+		},
+		"shell": {
+			Usage:    "shell command [args...]",
+			Help:     "runs a shell command in the terminal, for commands that need input",
+			Run:      (*View).shellCommand,
+			Complete: completeFileArgs,
+			Raw:      true,
+		},
+		"help": {
+			Usage:    "help [command]",
+			Help:     "shows how to use a command, or lists them all",
+			Run:      (*View).helpCommand,
+			Complete: argCompleter(completeCommandName),
+		},
+	}
+	bindingActions["CommandMode"] = (*View).CommandMode
+	for name, action := range bindingActions {
+		if _, ok := commands[name]; !ok {
+			commands[name] = actionCommand(name, action)
+		}
+	}
+}
+
+// actionCommand returns the command that runs an action
+func actionCommand(name string, action func(*View) bool) Command {
+	return Command{
+		Usage: name,
+		Help:  "runs the " + name + " action",
+		Run: func(v *View, args []string) {
+			if len(args) > 0 {
+				messenger.Alert(name, " takes no arguments")
+				return
+			}
+			v.ExecuteActions([]func(*View) bool{action})
+		},
+	}
+}
+
+// CommandMode opens the command bar and runs the command typed into it
+func (v *View) CommandMode() bool {
+	input, canceled := messenger.Prompt("> ", "", "Command", completeCommandLine)
+	if !canceled {
+		v.RunCommandLine(input)
+	}
+
+	return true
+}
+
+// RunCommandLine runs a line typed into the command bar: a command followed
+// by its arguments
+func (v *View) RunCommandLine(input string) {
+	input = strings.TrimSpace(input)
+	args := SplitCommandArgs(input)
+	if args[0] == "" {
+		return
+	}
+	if cmd, ok := commands[args[0]]; ok {
+		if cmd.Raw {
+			args = nil
+			if i := strings.IndexAny(input, " \t"); i >= 0 {
+				args = []string{strings.TrimSpace(input[i:])}
+			}
+		} else {
+			args = args[1:]
+		}
+		cmd.Run(v, args)
+	} else {
+		messenger.Alert("unknown command: ", args[0])
+	}
+}
+
+// argCompleter returns a Completer that completes the nth argument of a
+// command with the nth of the functions given
+func argCompleter(complete ...func(string) []string) Completer {
+	return func(args []string) []string {
+		if len(args) > len(complete) {
+			return nil
+		}
+		return complete[len(args)-1](args[len(args)-1])
+	}
+}
+
+// completeCommandLine completes the command name or the arguments of the
+// command typed so far
+func completeCommandLine(args []string) []string {
+	if len(args) == 1 {
+		return completeCommandName(args[0])
+	}
+	if cmd, ok := commands[args[0]]; ok && cmd.Complete != nil {
+		return cmd.Complete(args[1:])
+	}
+	return nil
+}
+
+// withPrefix returns the names that start with prefix, sorted
+func withPrefix(names []string, prefix string) []string {
+	var matches []string
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+func completeCommandName(prefix string) []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	return withPrefix(names, prefix)
+}
+
+func completeAction(prefix string) []string {
+	names := make([]string, 0, len(bindingActions))
+	for name := range bindingActions {
+		names = append(names, name)
+	}
+	return withPrefix(names, prefix)
+}
+
+func completeOption(prefix string) []string {
+	names := make([]string, 0, len(options))
+	for _, o := range options {
+		names = append(names, o.Name)
+	}
+	return withPrefix(names, prefix)
+}
+
+// completeKey completes a key name, which may follow modifiers
+func completeKey(prefix string) []string {
+	name := prefix
+	for _, mod := range []string{"Ctrl", "Alt", "Shift"} {
+		name = strings.TrimPrefix(strings.TrimLeft(name, "-"), mod)
+	}
+	mods := prefix[:len(prefix)-len(name)]
+
+	var keys []string
+	for k := range bindingKeys {
+		// Names like CtrlA already have their modifier
+		if strings.HasPrefix(k, name) && !(mods != "" && strings.HasPrefix(k, "Ctrl")) {
+			keys = append(keys, mods+k)
+		} else if mods != "" && strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// completeFile completes a path. Directories end with a slash so their
+// files can be completed next
+func completeFile(prefix string) []string {
+	dir, base := filepath.Split(prefix)
+	files, err := ioutil.ReadDir(filepath.Join(".", dir))
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, f := range files {
+		if !strings.HasPrefix(f.Name(), base) || (strings.HasPrefix(f.Name(), ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		path := dir + f.Name()
+		if f.IsDir() {
+			path += "/"
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// completeFileArgs completes any argument as a path
+func completeFileArgs(args []string) []string {
+	return completeFile(args[len(args)-1])
+}
+
+// completeSet completes the arguments of set and setlocal: the option, then
+// true or false for bool options
+func completeSet(args []string) []string {
+	if args[0] == "-save" {
+		args = args[1:]
+	}
+	switch len(args) {
+	case 1:
+		return completeOption(args[0])
+	case 2:
+		if o, ok := optionsByName[args[0]]; ok {
+			if _, ok := o.Default.(bool); ok {
+				return withPrefix([]string{"true", "false"}, args[1])
+			}
+		}
+	}
+	return nil
+}
+
+// shellCmd returns the command that runs command with the user's shell
+func shellCmd(command string) *exec.Cmd {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "sh"
+	}
+	return exec.Command(shell, "-c", command)
+}
+
+func (v *View) openCommand(args []string) {
+	if len(args) != 1 {
+		messenger.Alert("usage: open file")
+		return
+	}
+	if v.CanClose() {
+		v.Open(args[0])
+	}
+}
+
+func (v *View) saveCommand(args []string) {
+	if len(args) != 0 {
+		messenger.Alert("usage: save")
+		return
+	}
+	v.Save()
+}
+
+func (v *View) saveAsCommand(args []string) {
+	if len(args) != 1 {
+		messenger.Alert("usage: saveas file")
+		return
+	}
+	v.saveToFile(args[0])
+}
+
+func (v *View) quitCommand(args []string) {
+	v.Quit()
+}
+
+func (v *View) gotoCommand(args []string) {
+	if len(args) != 1 {
+		messenger.Alert("usage: goto line[:col]")
+		return
+	}
+	parts := strings.SplitN(args[0], ":", 2)
+	line, err := strconv.Atoi(parts[0])
+	col := 1
+	if err == nil && len(parts) == 2 {
+		col, err = strconv.Atoi(parts[1])
+	}
+	if err != nil {
+		messenger.Alert(err)
+		return
+	}
+	if line < 1 || line > v.Buf.NumLines {
+		messenger.Alert("only ", v.Buf.NumLines, " lines to jump")
+		return
+	}
+	v.recordJump()
+	v.Cursor.ResetSelection()
+	v.Cursor.Loc = Loc{Min(Max(col-1, 0), Count(v.Buf.Line(line-1))), line - 1}
+	v.Cursor.LastVisualX = v.Cursor.GetVisualX()
+}
+
+func (v *View) replaceCommand(args []string) {
+	if len(args) != 2 || args[0] == "" {
+		messenger.Alert("usage: replace search replacement")
+		return
+	}
+	Replace(args)
+}
+
+func (v *View) bindCommand(args []string) {
+	if len(args) != 2 {
+		messenger.Alert("usage: bind key action[,action...]")
+		return
+	}
+	if err := bindKey(args[0], args[1]); err != nil {
+		messenger.Alert(err)
+	}
+}
+
+func (v *View) filterCommand(args []string) {
+	if len(args) == 0 || args[0] == "" {
+		messenger.Alert("usage: filter command [args...]")
+		return
+	}
+	v.filter(args[0])
+}
+
+func (v *View) runCommand(args []string) {
+	if len(args) == 0 || args[0] == "" {
+		messenger.Alert("usage: run command [args...]")
+		return
+	}
+	v.run(args[0])
+}
+
+// shellCommand runs a shell command with the terminal to itself and waits
+// for enter once it is done
+func (v *View) shellCommand(args []string) {
+	if len(args) == 0 || args[0] == "" {
+		messenger.Alert("usage: shell command [args...]")
+		return
+	}
+	screen.Fini()
+	screen = nil
+
+	cmd := shellCmd(args[0])
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		TermMessage(err)
+	} else {
+		TermMessage()
+	}
+
+	InitScreen()
+}
+
+func (v *View) helpCommand(args []string) {
+	if len(args) > 1 {
+		messenger.Alert("usage: help [command]")
+		return
+	}
+	if len(args) == 1 {
+		cmd, ok := commands[args[0]]
+		if !ok {
+			messenger.Alert("unknown command: ", args[0])
+			return
+		}
+		messenger.Alert(cmd.Usage, ": ", cmd.Help)
+		return
+	}
+
+	names := completeCommandName("")
+	list := make([]string, len(names))
+	for i, name := range names {
+		list[i] = fmt.Sprintf("%s: %s", commands[name].Usage, commands[name].Help)
+	}
+	messenger.Choose("commands ", list)
+}
@@ -0,0 +1,110 @@
+package main
+
+import "strings"
+
+// commentTokens returns the strings that start and end a comment covering
+// one line in the given language. end is empty for line comments
+func commentTokens(lang Language) (start, end string) {
+	if lang.LineComment != "" {
+		return lang.LineComment + " ", ""
+	}
+	return lang.BlockComment[0] + " ", " " + lang.BlockComment[1]
+}
+
+// isCommented returns whether the given line, stripped of its leading
+// whitespace, is commented with the given tokens
+func isCommented(line, start, end string) bool {
+	line = strings.TrimLeft(line, " \t")
+	start, end = strings.TrimSpace(start), strings.TrimSpace(end)
+	return strings.HasPrefix(line, start) && strings.HasSuffix(line, end)
+}
+
+// uncommentLine removes the comment tokens from a commented line. It also
+// returns the number of runes removed in front of the text
+func uncommentLine(line, start, end string) (string, int) {
+	ws := GetLeadingWhitespace(line)
+	line = line[len(ws):]
+	if !strings.HasPrefix(line, start) {
+		start = strings.TrimSpace(start)
+	}
+	line = line[len(start):]
+	if end != "" {
+		if strings.HasSuffix(line, end) {
+			line = line[:len(line)-len(end)]
+		} else {
+			line = line[:len(line)-len(strings.TrimSpace(end))]
+		}
+	}
+	return ws + line, Count(start)
+}
+
+// ToggleComment comments or uncomments the current line or the selected lines
+// If every non-blank line is already commented the lines are uncommented,
+// otherwise they are all commented at the smallest indentation among them
+func (v *View) ToggleComment() bool {
+	lang, ok := v.Buf.Language()
+	if !ok || (lang.LineComment == "" && lang.BlockComment[0] == "") {
+		messenger.Alert("no comment syntax known for file type ", v.Buf.FileType)
+		return false
+	}
+	start, end := commentTokens(lang)
+
+	first, last := v.Cursor.SelectedLines()
+	commented := true
+	indent := -1
+	for y := first; y <= last; y++ {
+		line := v.Buf.Line(y)
+		if IsSpacesOrTabs(line) {
+			continue
+		}
+		if !isCommented(line, start, end) {
+			commented = false
+		}
+		if ws := Count(GetLeadingWhitespace(line)); indent < 0 || ws < indent {
+			indent = ws
+		}
+	}
+	if indent < 0 {
+		// Only blank lines
+		return false
+	}
+
+	var deltas []Delta
+	// How far the text on the cursor's line moves
+	shift := 0
+	for y := first; y <= last; y++ {
+		line := v.Buf.Line(y)
+		if IsSpacesOrTabs(line) {
+			continue
+		}
+		var text string
+		n := Count(start)
+		if commented {
+			text, n = uncommentLine(line, start, end)
+			n = -n
+		} else {
+			runes := []rune(line)
+			text = string(runes[:indent]) + start + string(runes[indent:]) + end
+		}
+		if y == v.Cursor.Y {
+			shift = n
+		}
+		deltas = append(deltas, Delta{text, Loc{0, y}, Loc{Count(line), y}})
+	}
+
+	v.Buf.MultipleReplace(deltas)
+
+	if v.Cursor.HasSelection() {
+		// Select the whole lines that were toggled
+		v.Cursor.SetSelectionStart(Loc{0, first})
+		v.Cursor.SetSelectionEnd(Loc{Count(v.Buf.Line(last)), last})
+		v.Cursor.OrigSelection = v.Cursor.CurSelection
+		v.Cursor.Loc = v.Cursor.CurSelection[1]
+	} else if v.Cursor.X >= indent {
+		v.Cursor.X = Max(indent, v.Cursor.X+shift)
+	}
+	v.Cursor.Relocate()
+	v.Cursor.LastVisualX = v.Cursor.GetVisualX()
+
+	return true
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/dgv/zed/runewidth"
+	"github.com/dgv/zed/tcell"
+)
+
+// maxCompletions is the number of completions shown at once
+const maxCompletions = 8
+
+// WordIndex keeps track of the words in a buffer and how often they occur.
+// It is updated line by line as the buffer changes
+type WordIndex struct {
+	// The words on every line of the buffer
+	lines [][]string
+	// How many times every word occurs in the buffer
+	counts map[string]int
+}
+
+// lineWords splits a line into its words. Words shorter than two characters
+// are not worth completing and are left out
+func lineWords(line string) []string {
+	var words []string
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		if !IsWordChar(string(runes[i])) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && IsWordChar(string(runes[j])) {
+			j++
+		}
+		if j-i > 1 {
+			words = append(words, string(runes[i:j]))
+		}
+		i = j
+	}
+	return words
+}
+
+// NewWordIndex indexes the words of every line in the buffer
+func NewWordIndex(b *Buffer) *WordIndex {
+	w := &WordIndex{
+		lines:  make([][]string, b.LinesNum()),
+		counts: make(map[string]int),
+	}
+	for y := range w.lines {
+		w.setLine(y, b.Line(y))
+	}
+	return w
+}
+
+// setLine replaces the words indexed for line y with the words in line
+func (w *WordIndex) setLine(y int, line string) {
+	for _, word := range w.lines[y] {
+		if w.counts[word]--; w.counts[word] <= 0 {
+			delete(w.counts, word)
+		}
+	}
+	w.lines[y] = lineWords(line)
+	for _, word := range w.lines[y] {
+		w.counts[word]++
+	}
+}
+
+// inserted updates the index after text containing n newlines was inserted
+// on line y
+func (w *WordIndex) inserted(b *Buffer, y, n int) {
+	if n > 0 {
+		w.lines = append(w.lines[:y+1], append(make([][]string, n), w.lines[y+1:]...)...)
+	}
+	for i := y; i <= y+n; i++ {
+		w.setLine(i, b.Line(i))
+	}
+}
+
+// removed updates the index after the text from line start to line end was
+// removed, joining them into line start
+func (w *WordIndex) removed(b *Buffer, start, end int) {
+	for i := start + 1; i <= end; i++ {
+		w.setLine(i, "")
+	}
+	w.lines = append(w.lines[:start+1], w.lines[end+1:]...)
+	w.setLine(start, b.Line(start))
+}
+
+// Completion is the list of words offered to complete the word at the cursor
+type Completion struct {
+	// Where the word being completed starts
+	start  Loc
+	prefix string
+
+	items    []string
+	selected int
+}
+
+// wordBeforeCursor returns where the word that ends at the cursor starts, and
+// the word itself
+func (v *View) wordBeforeCursor() (Loc, string) {
+	x := v.Cursor.X
+	for x > 0 && IsWordChar(string(v.Cursor.RuneUnder(x-1))) {
+		x--
+	}
+	line := []rune(v.Buf.Line(v.Cursor.Y))
+	return Loc{x, v.Cursor.Y}, string(line[x:v.Cursor.X])
+}
+
+// completions returns the words in the open buffers that start with prefix.
+// Words closer to the cursor come first, and among equally close words the
+// more frequent ones do
+func (v *View) completions(prefix string) []string {
+	counts := make(map[string]int)
+	for _, view := range views {
+		for word, n := range view.Buf.words.counts {
+			if len(word) > len(prefix) && strings.HasPrefix(word, prefix) {
+				counts[word] += n
+			}
+		}
+	}
+	if len(counts) == 0 {
+		return nil
+	}
+
+	// Look for the candidates on the lines around the cursor, nearest first.
+	// Words found only in other buffers are as far away as possible
+	lines := v.Buf.words.lines
+	distance := make(map[string]int)
+	for d := 0; d < len(lines) && len(distance) < len(counts); d++ {
+		for _, y := range []int{v.Cursor.Y - d, v.Cursor.Y + d} {
+			if y < 0 || y >= len(lines) {
+				continue
+			}
+			for _, word := range lines[y] {
+				if _, ok := counts[word]; ok {
+					if _, seen := distance[word]; !seen {
+						distance[word] = d
+					}
+				}
+			}
+		}
+	}
+
+	items := make([]string, 0, len(counts))
+	for word := range counts {
+		items = append(items, word)
+		if _, ok := distance[word]; !ok {
+			distance[word] = len(lines)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if distance[a] != distance[b] {
+			return distance[a] < distance[b]
+		}
+		if counts[a] != counts[b] {
+			return counts[a] > counts[b]
+		}
+		return a < b
+	})
+	return items
+}
+
+// updateCompletion recomputes the completions for the word at the cursor and
+// closes the popup if there are none. The popup is only opened if the word
+// is at least minLen characters long
+func (v *View) updateCompletion(minLen int) {
+	start, prefix := v.wordBeforeCursor()
+	if prefix == "" || Count(prefix) < minLen {
+		v.completion = nil
+		return
+	}
+	items := v.completions(prefix)
+	if len(items) == 0 {
+		v.completion = nil
+		return
+	}
+	v.completion = &Completion{start: start, prefix: prefix, items: items}
+}
+
+// Autocomplete opens the completion popup for the word before the cursor
+func (v *View) Autocomplete() bool {
+	v.updateCompletion(1)
+	return v.completion != nil
+}
+
+// acceptCompletion inserts the rest of the selected completion
+func (v *View) acceptCompletion() {
+	c := v.completion
+	v.completion = nil
+	rest := strings.TrimPrefix(c.items[c.selected], c.prefix)
+	v.Buf.Insert(v.Cursor.Loc, rest)
+	v.Cursor.Loc = v.Cursor.Loc.Move(Count(rest), v.Buf)
+	v.Cursor.LastVisualX = v.Cursor.GetVisualX()
+}
+
+// handleCompletionKey handles the keys that navigate the completion popup.
+// It returns false for keys the popup has no use for
+func (v *View) handleCompletionKey(e *tcell.EventKey) bool {
+	c := v.completion
+	switch e.Key() {
+	case tcell.KeyUp, tcell.KeyBacktab:
+		c.selected = (c.selected + len(c.items) - 1) % len(c.items)
+	case tcell.KeyDown, tcell.KeyTab:
+		c.selected = (c.selected + 1) % len(c.items)
+	case tcell.KeyEnter:
+		v.acceptCompletion()
+	case tcell.KeyEscape:
+		v.completion = nil
+	default:
+		return false
+	}
+	return true
+}
+
+// completionKeyDone keeps the completion popup in step with the key that was
+// just handled. before is the popup that was open when the key was pressed
+func (v *View) completionKeyDone(e *tcell.EventKey, isBinding bool, before *Completion) {
+	switch {
+	case !isBinding && e.Key() == tcell.KeyRune && IsWordChar(string(e.Rune())):
+		if before != nil {
+			v.updateCompletion(1)
+		} else if n := v.Buf.IntOption("autocomplete"); n > 0 {
+			v.updateCompletion(n)
+		}
+	case before != nil && (e.Key() == tcell.KeyBackspace || e.Key() == tcell.KeyBackspace2):
+		v.updateCompletion(1)
+	case before != nil && v.completion == before:
+		// Any other key closes the popup
+		v.completion = nil
+	}
+}
+
+// displayCompletion draws the completion popup below the word being
+// completed, or above it if there is no room below
+func (v *View) displayCompletion() {
+	c := v.completion
+	if c == nil {
+		return
+	}
+
+	items := c.items
+	first := 0
+	if len(items) > maxCompletions {
+		first = Min(Max(0, c.selected-maxCompletions/2), len(items)-maxCompletions)
+		items = items[first : first+maxCompletions]
+	}
+
+	width := 0
+	for _, item := range items {
+		width = Max(width, runewidth.StringWidth(item)+2)
+	}
+
+	x, y := v.screenPos(c.start)
+	if y+1+len(items) > v.y+v.Height {
+		y -= len(items)
+	} else {
+		y++
+	}
+	x = Max(v.x, Min(x, v.x+v.Width-width))
+
+	for i, item := range items {
+		style := defStyle.Reverse(true)
+		if first+i == c.selected {
+			style = defStyle.Bold(true)
+		}
+		text := []rune(" " + item + Spaces(width))
+		for col := 0; col < width; {
+			screen.SetContent(x+col, y+i, text[0], nil, style)
+			col += runewidth.RuneWidth(text[0])
+			text = text[1:]
+		}
+	}
+}
@@ -1,7 +1,5 @@
 package main
 
-import "github.com/dgv/clipboard"
-
 // The Cursor struct stores the location of the cursor in the view
 // The complicated part about the cursor is storing its location.
 // The cursor must be displayed at an x, y location, but since the buffer
@@ -29,11 +27,19 @@ func (c *Cursor) Goto(b Cursor) {
 	c.OrigSelection, c.CurSelection = b.OrigSelection, b.CurSelection
 }
 
-// CopySelection copies the user's selection to either "primary" or "clipboard"
+// CopySelection copies the user's selection to either "clipboard", in which
+// case it is also added to the kill ring, or to one of the registers a-z
 func (c *Cursor) CopySelection(target string) {
-	if c.HasSelection() {
-		clipboard.WriteAll(c.GetSelection())
+	if !c.HasSelection() {
+		return
 	}
+	sel := c.GetSelection()
+	if reg, ok := parseRegister(target, 0); ok && reg != 0 {
+		registers[reg] = sel
+		return
+	}
+	pushKill(sel)
+	WriteClipboard(sel)
 }
 
 // ResetSelection resets the user's selection
@@ -81,6 +87,23 @@ func (c *Cursor) GetSelection() string {
 	return ""
 }
 
+// SelectedLines returns the first and last line covered by the selection, or
+// the cursor's line if there is no selection. A selection ending at the very
+// start of a line does not cover that line
+func (c *Cursor) SelectedLines() (int, int) {
+	if !c.HasSelection() {
+		return c.Y, c.Y
+	}
+	start, end := c.CurSelection[0], c.CurSelection[1]
+	if start.GreaterThan(end) {
+		start, end = end, start
+	}
+	if end.X == 0 && end.Y > start.Y {
+		end.Y--
+	}
+	return start.Y, end.Y
+}
+
 // SelectLine selects the current line
 func (c *Cursor) SelectLine() {
 	c.Start()
@@ -316,7 +339,7 @@ func (c *Cursor) Start() {
 // GetCharPosInLine gets the char position of a visual x y coordinate (this is necessary because tabs are 1 char but 4 visual spaces)
 func (c *Cursor) GetCharPosInLine(lineNum, visualPos int) int {
 	// Get the tab size
-	tabSize := *flagTabSize
+	tabSize := c.buf.IntOption("tabsize")
 	visualLineLen := StringWidth(c.buf.Line(lineNum), tabSize)
 	if visualPos > visualLineLen {
 		visualPos = visualLineLen
@@ -331,7 +354,7 @@ func (c *Cursor) GetCharPosInLine(lineNum, visualPos int) int {
 // GetVisualX returns the x value of the cursor in visual spaces
 func (c *Cursor) GetVisualX() int {
 	runes := []rune(c.buf.Line(c.Y))
-	tabSize := *flagTabSize
+	tabSize := c.buf.IntOption("tabsize")
 	return StringWidth(string(runes[:c.X]), tabSize)
 }
 
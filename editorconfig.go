@@ -0,0 +1,323 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// An editorConfigSection is a section of an .editorconfig file: the
+// properties for the files its glob matches
+type editorConfigSection struct {
+	glob  *editorConfigGlob
+	props map[string]string
+}
+
+// An editorConfigGlob matches paths with an EditorConfig glob. The
+// {num1..num2} ranges in it are matched by the groups of the regexp
+type editorConfigGlob struct {
+	regex  *regexp.Regexp
+	ranges [][2]int
+}
+
+var numRangeRegex = regexp.MustCompile(`^([+-]?\d+)\.\.([+-]?\d+)$`)
+
+// compileEditorConfigGlob compiles the glob of a section in the
+// .editorconfig file in dir. Globs without a slash match files of that name
+// in dir and any directory below it, the others are relative to dir
+func compileEditorConfigGlob(dir, pattern string) (*editorConfigGlob, error) {
+	g := new(editorConfigGlob)
+	prefix := regexp.QuoteMeta(strings.TrimSuffix(filepath.ToSlash(dir), "/") + "/")
+	if !strings.Contains(pattern, "/") {
+		prefix += "(?:.*/)?"
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	regex, err := regexp.Compile("^" + prefix + g.translate([]rune(pattern)) + "$")
+	if err != nil {
+		return nil, err
+	}
+	g.regex = regex
+	return g, nil
+}
+
+// translate returns the regexp for a glob
+func (g *editorConfigGlob) translate(glob []rune) string {
+	var re strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				re.WriteString(regexp.QuoteMeta(string(glob[i])))
+			} else {
+				re.WriteString(`\\`)
+			}
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				re.WriteString(".*")
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		case '[':
+			end := closingBracket(glob, i)
+			if end < 0 {
+				re.WriteString(`\[`)
+				continue
+			}
+			set := glob[i+1 : end]
+			re.WriteString("[")
+			if len(set) > 0 && set[0] == '!' {
+				re.WriteString("^")
+				set = set[1:]
+			}
+			for _, r := range set {
+				if r == '\\' || r == '[' || r == ']' || r == '^' {
+					re.WriteRune('\\')
+				}
+				re.WriteRune(r)
+			}
+			re.WriteString("]")
+			i = end
+		case '{':
+			end := closingBrace(glob, i)
+			if end < 0 {
+				re.WriteString(`\{`)
+				continue
+			}
+			re.WriteString(g.translateBraces(glob[i+1 : end]))
+			i = end
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return re.String()
+}
+
+// translateBraces returns the regexp for the inside of {...}: a range of
+// numbers, alternatives separated by commas, or else the text itself
+func (g *editorConfigGlob) translateBraces(inner []rune) string {
+	if m := numRangeRegex.FindStringSubmatch(string(inner)); m != nil {
+		from, _ := strconv.Atoi(m[1])
+		to, _ := strconv.Atoi(m[2])
+		g.ranges = append(g.ranges, [2]int{from, to})
+		return `([+-]?\d+)`
+	}
+
+	var alternatives []string
+	depth, start := 0, 0
+	for i := 0; i < len(inner); i++ {
+		switch inner[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alternatives = append(alternatives, g.translate(inner[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if alternatives == nil {
+		return `\{` + g.translate(inner) + `\}`
+	}
+	alternatives = append(alternatives, g.translate(inner[start:]))
+	return "(?:" + strings.Join(alternatives, "|") + ")"
+}
+
+// closingBracket returns the index of the ] closing the [ at i, or -1
+func closingBracket(glob []rune, i int) int {
+	for j := i + 1; j < len(glob); j++ {
+		switch glob[j] {
+		case '\\':
+			j++
+		case '/':
+			return -1
+		case ']':
+			return j
+		}
+	}
+	return -1
+}
+
+// closingBrace returns the index of the } closing the { at i, or -1
+func closingBrace(glob []rune, i int) int {
+	depth := 0
+	for j := i; j < len(glob); j++ {
+		switch glob[j] {
+		case '\\':
+			j++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// match returns whether the glob matches path, which is absolute and uses
+// slashes
+func (g *editorConfigGlob) match(path string) bool {
+	m := g.regex.FindStringSubmatch(path)
+	if m == nil {
+		return false
+	}
+	for i, r := range g.ranges {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil || n < r[0] || n > r[1] {
+			return false
+		}
+	}
+	return true
+}
+
+// parseEditorConfig parses the .editorconfig file in dir. It returns whether
+// the file is the root one, which stops the search for more files
+func parseEditorConfig(dir string, data []byte) (bool, []editorConfigSection) {
+	root := false
+	var sections []editorConfigSection
+	var section *editorConfigSection
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			section = nil
+			end := strings.LastIndex(line, "]")
+			if end < 0 {
+				continue
+			}
+			glob, err := compileEditorConfigGlob(dir, line[1:end])
+			if err != nil {
+				continue
+			}
+			sections = append(sections, editorConfigSection{glob, make(map[string]string)})
+			section = &sections[len(sections)-1]
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:eq]))
+		value := strings.ToLower(strings.TrimSpace(line[eq+1:]))
+		if section != nil {
+			section.props[key] = value
+		} else if key == "root" {
+			root = value == "true"
+		}
+	}
+	return root, sections
+}
+
+// editorConfigProperties returns the properties the .editorconfig files in
+// the directories from path up to the root one give the file at path. Closer
+// files and later sections win
+func editorConfigProperties(path string) map[string]string {
+	var files [][]editorConfigSection
+	for dir := filepath.Dir(path); ; {
+		data, err := ioutil.ReadFile(filepath.Join(dir, ".editorconfig"))
+		if err == nil {
+			root, sections := parseEditorConfig(dir, data)
+			files = append(files, sections)
+			if root {
+				break
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	props := make(map[string]string)
+	path = filepath.ToSlash(path)
+	for i := len(files) - 1; i >= 0; i-- {
+		for _, s := range files[i] {
+			if !s.glob.match(path) {
+				continue
+			}
+			for k, v := range s.props {
+				if v == "unset" {
+					delete(props, k)
+				} else {
+					props[k] = v
+				}
+			}
+		}
+	}
+	return props
+}
+
+// editorConfigSettings converts EditorConfig properties to the options
+// they stand for
+func editorConfigSettings(props map[string]string) map[string]string {
+	settings := make(map[string]string)
+	switch props["indent_style"] {
+	case "tab":
+		settings["tabstospaces"] = "false"
+	case "space":
+		settings["tabstospaces"] = "true"
+	}
+
+	// zed has a single size for tabs and indents. With spaces the indent
+	// size matters most, with tabs the tab width
+	indentSize, tabWidth := props["indent_size"], props["tab_width"]
+	if indentSize == "tab" {
+		indentSize = ""
+	}
+	if tabWidth == "" || (indentSize != "" && props["indent_style"] == "space") {
+		tabWidth = indentSize
+	}
+	if n, err := strconv.Atoi(tabWidth); err == nil && validInt("tabsize", n) {
+		settings["tabsize"] = tabWidth
+	}
+
+	switch props["end_of_line"] {
+	case "lf":
+		settings["fileformat"] = "unix"
+	case "crlf":
+		settings["fileformat"] = "dos"
+	case "cr":
+		settings["fileformat"] = "mac"
+	}
+	if charset, ok := props["charset"]; ok {
+		settings["encoding"] = charset
+	}
+	if trim, ok := props["trim_trailing_whitespace"]; ok {
+		settings["rmtrailingws"] = trim
+	}
+	if newline, ok := props["insert_final_newline"]; ok {
+		settings["eofnewline"] = newline
+	}
+	if n, err := strconv.Atoi(props["max_line_length"]); err == nil && validInt("textwidth", n) {
+		settings["textwidth"] = props["max_line_length"]
+	}
+	return settings
+}
+
+// applyEditorConfig sets the buffer's options from the .editorconfig files
+// that cover it. Values zed can't use are ignored
+func (b *Buffer) applyEditorConfig() {
+	if b.Path == "" || !BoolOption("editorconfig") {
+		return
+	}
+	for name, value := range editorConfigSettings(editorConfigProperties(b.AbsPath)) {
+		b.SetLocalOption(name, value, false)
+	}
+}
@@ -24,6 +24,8 @@ type TextEvent struct {
 	EventType int
 	Deltas    []Delta
 	Time      time.Time
+	// Events sharing a non-zero group are undone and redone together
+	Group int
 }
 
 type Delta struct {
@@ -46,6 +48,8 @@ func ExecuteTextEvent(t *TextEvent, buf *Buffer) {
 		for i, d := range t.Deltas {
 			t.Deltas[i].Text = buf.remove(d.Start, d.End)
 			buf.insert(d.Start, []byte(d.Text))
+			// The replacement may differ in length, so undoing must remove up to its end
+			t.Deltas[i].End = d.Start.Move(Count(d.Text), buf)
 		}
 	}
 }
@@ -61,6 +65,13 @@ type EventHandler struct {
 	buf       *Buffer
 	UndoStack *Stack
 	RedoStack *Stack
+
+	// The group new events are added to, 0 if there is none
+	group int
+	// The last group number handed out
+	groupCount int
+	// How many BeginGroup calls are still waiting for their EndGroup
+	groupDepth int
 }
 
 // NewEventHandler returns a new EventHandler
@@ -132,11 +143,36 @@ func (eh *EventHandler) Replace(start, end Loc, replace string) {
 	eh.Insert(start, replace)
 }
 
+// BeginGroup starts a group of events that are undone and redone as one.
+// Groups may be nested, in which case the outermost one wins
+func (eh *EventHandler) BeginGroup() {
+	if eh.groupDepth == 0 {
+		eh.groupCount++
+		eh.group = eh.groupCount
+	}
+	eh.groupDepth++
+}
+
+// EndGroup ends the group started by the matching BeginGroup
+func (eh *EventHandler) EndGroup() {
+	if eh.groupDepth == 0 {
+		return
+	}
+	eh.groupDepth--
+	if eh.groupDepth == 0 {
+		eh.group = 0
+	}
+}
+
 // Execute a textevent and add it to the undo stack
 func (eh *EventHandler) Execute(t *TextEvent) {
+	if eh.buf.ReadOnly {
+		return
+	}
 	if eh.RedoStack.Len() > 0 {
 		eh.RedoStack = new(Stack)
 	}
+	t.Group = eh.group
 	eh.UndoStack.Push(t)
 
 	ExecuteTextEvent(t, eh.buf)
@@ -149,13 +185,21 @@ func (eh *EventHandler) Undo() {
 		return
 	}
 
+	if group := t.Group; group != 0 {
+		for t != nil && t.Group == group {
+			eh.UndoOneEvent()
+			t = eh.UndoStack.Peek()
+		}
+		return
+	}
+
 	startTime := t.Time.UnixNano() / int64(time.Millisecond)
 
 	eh.UndoOneEvent()
 
 	for {
 		t = eh.UndoStack.Peek()
-		if t == nil {
+		if t == nil || t.Group != 0 {
 			return
 		}
 
@@ -197,13 +241,21 @@ func (eh *EventHandler) Redo() {
 		return
 	}
 
+	if group := t.Group; group != 0 {
+		for t != nil && t.Group == group {
+			eh.RedoOneEvent()
+			t = eh.RedoStack.Peek()
+		}
+		return
+	}
+
 	startTime := t.Time.UnixNano() / int64(time.Millisecond)
 
 	eh.RedoOneEvent()
 
 	for {
 		t = eh.RedoStack.Peek()
-		if t == nil {
+		if t == nil || t.Group != 0 {
 			return
 		}
 
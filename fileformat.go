@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// lineEnding returns the line ending written for a fileformat
+func lineEnding(fileformat string) string {
+	switch fileformat {
+	case "dos":
+		return "\r\n"
+	case "mac":
+		return "\r"
+	}
+	return "\n"
+}
+
+// decodeText returns the text of a file read with the given encoding and
+// line endings
+func decodeText(data []byte, encoding, fileformat string) string {
+	var text string
+	switch encoding {
+	case "utf-8-bom":
+		text = string(bytes.TrimPrefix(data, utf8BOM))
+	case "latin1":
+		runes := make([]rune, len(data))
+		for i, c := range data {
+			runes[i] = rune(c)
+		}
+		text = string(runes)
+	case "utf-16be", "utf-16le":
+		var order binary.ByteOrder = binary.BigEndian
+		if encoding == "utf-16le" {
+			order = binary.LittleEndian
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = order.Uint16(data[2*i:])
+		}
+		if len(units) > 0 && units[0] == 0xfeff {
+			units = units[1:]
+		}
+		text = string(utf16.Decode(units))
+	default:
+		text = string(data)
+	}
+
+	if ending := lineEnding(fileformat); ending != "\n" {
+		text = strings.Replace(text, ending, "\n", -1)
+	}
+	return text
+}
+
+// encodeText returns the contents of a file holding text, with the given
+// encoding and line endings
+func encodeText(text, encoding, fileformat string) ([]byte, error) {
+	if ending := lineEnding(fileformat); ending != "\n" {
+		text = strings.Replace(text, "\n", ending, -1)
+	}
+
+	switch encoding {
+	case "utf-8-bom":
+		return append(append([]byte{}, utf8BOM...), text...), nil
+	case "latin1":
+		data := make([]byte, 0, len(text))
+		for _, r := range text {
+			if r > 0xff {
+				return nil, fmt.Errorf("%q can't be saved as latin1", r)
+			}
+			data = append(data, byte(r))
+		}
+		return data, nil
+	case "utf-16be", "utf-16le":
+		var order binary.ByteOrder = binary.BigEndian
+		if encoding == "utf-16le" {
+			order = binary.LittleEndian
+		}
+		units := utf16.Encode([]rune(text))
+		data := make([]byte, 2*len(units))
+		for i, u := range units {
+			order.PutUint16(data[2*i:], u)
+		}
+		return data, nil
+	}
+	return []byte(text), nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// fileTypeExtensions maps a file extension (including the dot) to a file type
+var fileTypeExtensions = map[string]string{
+	".go":       "go",
+	".py":       "python",
+	".sh":       "shell",
+	".bash":     "shell",
+	".zsh":      "shell",
+	".c":        "c",
+	".h":        "c",
+	".cc":       "c++",
+	".cpp":      "c++",
+	".cxx":      "c++",
+	".hpp":      "c++",
+	".java":     "java",
+	".js":       "javascript",
+	".ts":       "typescript",
+	".json":     "json",
+	".rs":       "rust",
+	".rb":       "ruby",
+	".lua":      "lua",
+	".sql":      "sql",
+	".yml":      "yaml",
+	".yaml":     "yaml",
+	".toml":     "toml",
+	".ini":      "ini",
+	".md":       "markdown",
+	".markdown": "markdown",
+	".html":     "html",
+	".htm":      "html",
+	".xml":      "xml",
+	".css":      "css",
+	".lisp":     "lisp",
+	".el":       "lisp",
+	".clj":      "clojure",
+	".scm":      "lisp",
+	".hs":       "haskell",
+	".tex":      "tex",
+	".vim":      "vim",
+	".txt":      "text",
+}
+
+// fileTypeNames maps special file names to a file type
+var fileTypeNames = map[string]string{
+	"Makefile":    "make",
+	"makefile":    "make",
+	"GNUmakefile": "make",
+	"Dockerfile":  "dockerfile",
+	".bashrc":     "shell",
+	".profile":    "shell",
+	".zshrc":      "shell",
+}
+
+// DetectFileType returns the file type for the given path, or "unknown"
+// if it could not be detected
+func DetectFileType(path string) string {
+	base := filepath.Base(path)
+	if ft, ok := fileTypeNames[base]; ok {
+		return ft
+	}
+	if ft, ok := fileTypeExtensions[strings.ToLower(filepath.Ext(base))]; ok {
+		return ft
+	}
+	return "unknown"
+}
+
+// fileTypeAliases maps the names other editors use for file types to zed's
+var fileTypeAliases = map[string]string{
+	"sh":           "shell",
+	"bash":         "shell",
+	"zsh":          "shell",
+	"shell-script": "shell",
+	"cpp":          "c++",
+	"js":           "javascript",
+	"js2":          "javascript",
+	"emacs-lisp":   "lisp",
+	"scheme":       "lisp",
+	"makefile":     "make",
+	"md":           "markdown",
+	"latex":        "tex",
+	"plaintex":     "tex",
+	"yml":          "yaml",
+}
+
+// lookupFileType returns zed's file type for a file type name given in a
+// file, and whether it is one zed knows
+func lookupFileType(name string) (string, bool) {
+	name = strings.ToLower(name)
+	if ft, ok := fileTypeAliases[name]; ok {
+		return ft, true
+	}
+	for _, ft := range fileTypeExtensions {
+		if ft == name {
+			return ft, true
+		}
+	}
+	for _, ft := range fileTypeNames {
+		if ft == name {
+			return ft, true
+		}
+	}
+	return "", false
+}
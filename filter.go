@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dgv/zed/tcell"
+)
+
+// FilterThroughCommand asks for a shell command, feeds it the selection or
+// the whole buffer and replaces that with what the command prints
+func (v *View) FilterThroughCommand() bool {
+	command, canceled := messenger.Prompt("filter through: ", "", "Filter")
+	if canceled || strings.TrimSpace(command) == "" {
+		return false
+	}
+	v.filter(command)
+
+	return true
+}
+
+// filter replaces the selection, or the whole buffer, with the output of a
+// shell command given it as input. The text is left alone if the command
+// fails, and the change is undone in one step
+func (v *View) filter(command string) {
+	start, end := v.Buf.Start(), v.Buf.End()
+	selected := v.Cursor.HasSelection()
+	if selected {
+		start, end = v.Cursor.CurSelection[0], v.Cursor.CurSelection[1]
+		if start.GreaterThan(end) {
+			start, end = end, start
+		}
+	}
+	input := v.Buf.Substr(start, end)
+
+	output, err := v.runFilter(command, input)
+	if err != nil {
+		messenger.Alert(err)
+		return
+	}
+	// Commands end their output with a newline, which the text may not have
+	if !strings.HasSuffix(input, "\n") {
+		output = strings.TrimSuffix(output, "\n")
+	}
+	if output == input {
+		return
+	}
+
+	v.Buf.BeginGroup()
+	if selected {
+		v.Buf.Replace(start, end, output)
+		v.Cursor.SetSelectionStart(start)
+		v.Cursor.SetSelectionEnd(start.Move(Count(output), v.Buf))
+		v.Cursor.Loc = v.Cursor.CurSelection[1]
+	} else {
+		v.Buf.ApplyDiff(output)
+	}
+	v.Buf.EndGroup()
+	v.Cursor.Relocate()
+}
+
+// runFilter runs a shell command in the buffer's directory with input on its
+// stdin and returns what it printed. It fails if the command exits with an
+// error, runs for longer than the commandtimeout option allows, or is
+// canceled with ctrl-c or escape. Other events wait until it is done
+func (v *View) runFilter(command, input string) (string, error) {
+	cmd := shellCmd(command)
+	if v.Buf.Path != "" {
+		cmd.Dir = filepath.Dir(v.Buf.AbsPath)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	// The commands the shell starts are killed with it, but ones that left
+	// its process group may hold the output open, so don't wait long
+	setProcessGroup(cmd)
+	cmd.WaitDelay = time.Second
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var timeout <-chan time.Time
+	if seconds := IntOption("commandtimeout"); seconds > 0 {
+		timeout = time.After(time.Duration(seconds) * time.Second)
+	}
+	if screen != nil {
+		messenger.PromptText("running ", command, " (ctrl-c or esc to cancel)")
+		messenger.Display()
+		screen.Show()
+		defer messenger.Reset()
+	}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				if msg := strings.TrimSpace(stderr.String()); msg != "" {
+					return "", fmt.Errorf("%s: %s", command, strings.Replace(msg, "\n", " ", -1))
+				}
+				return "", fmt.Errorf("%s: %v", command, err)
+			}
+			return stdout.String(), nil
+		case <-timeout:
+			killProcessGroup(cmd.Process)
+			<-done
+			return "", fmt.Errorf("%s: timed out after %d seconds", command, IntOption("commandtimeout"))
+		case event := <-events:
+			switch e := event.(type) {
+			case *tcell.EventKey:
+				if e.Key() == tcell.KeyCtrlC || e.Key() == tcell.KeyEscape {
+					killProcessGroup(cmd.Process)
+					<-done
+					return "", fmt.Errorf("%s: canceled", command)
+				}
+			case *tcell.EventResize:
+				HandleEvent(e)
+				continue
+			}
+			// Anything else, such as keys typed ahead, is handled once the
+			// command is done
+			holdEvent(event)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// foldMarker is drawn in the gutter next to folded lines
+const foldMarker = '▸'
+
+// Markers that start and end a region that can be folded, such as
+// "// region" and "// endregion" or "#region" and "#endregion"
+var (
+	regionStartRegex = regexp.MustCompile(`^\s*(//|#|--|;+|/\*|<!--)\s*#?region\b`)
+	regionEndRegex   = regexp.MustCompile(`^\s*(//|#|--|;+|/\*|<!--)\s*#?endregion\b`)
+)
+
+// A Fold hides the lines after its first line, up to and including its last
+// line. Its ends are anchored so that it stays on the same lines while the
+// buffer around it is edited
+type Fold struct {
+	start, end *Anchor
+}
+
+// hides returns whether the fold hides line y
+func (f *Fold) hides(y int) bool {
+	return y > f.start.Y && y <= f.end.Y
+}
+
+// regionRange returns the lines of the region started by a marker on line y
+func (b *Buffer) regionRange(y int) (int, int, bool) {
+	if !regionStartRegex.MatchString(b.Line(y)) {
+		return 0, 0, false
+	}
+	depth := 0
+	for end := y + 1; end < b.NumLines; end++ {
+		line := b.Line(end)
+		if regionStartRegex.MatchString(line) {
+			depth++
+		} else if regionEndRegex.MatchString(line) {
+			if depth == 0 {
+				return y, end, true
+			}
+			depth--
+		}
+	}
+	return 0, 0, false
+}
+
+// A bracketIndex holds the brackets of a whole buffer paired up, so that
+// every line can be folded without searching for matches again
+type bracketIndex struct {
+	mask [][]bool
+	// The closing bracket of every opening bracket that has one
+	matches map[Loc]Loc
+}
+
+// indexBrackets pairs up the brackets in the code of the buffer in one pass
+func (b *Buffer) indexBrackets() *bracketIndex {
+	idx := &bracketIndex{mask: b.codeMask(0, b.NumLines), matches: make(map[Loc]Loc)}
+	open := make(map[rune][]Loc)
+	for y, mask := range idx.mask {
+		for x, r := range []rune(b.Line(y)) {
+			if !mask[x] {
+				continue
+			}
+			for _, bp := range bracePairs {
+				switch r {
+				case bp[0]:
+					open[r] = append(open[r], Loc{x, y})
+				case bp[1]:
+					if locs := open[bp[0]]; len(locs) > 0 {
+						idx.matches[locs[len(locs)-1]] = Loc{x, y}
+						open[bp[0]] = locs[:len(locs)-1]
+					}
+				}
+			}
+		}
+	}
+	return idx
+}
+
+// bracketRange returns the lines between the last unmatched opening bracket
+// on line y and its closing bracket. The line with the closing bracket stays
+// visible if the bracket starts it. Brackets are matched with idx if it
+// isn't nil, otherwise near the view
+func (v *View) bracketRange(y int, idx *bracketIndex) (int, int, bool) {
+	line := []rune(v.Buf.Line(y))
+	var mask []bool
+	if idx != nil {
+		mask = idx.mask[y]
+	} else {
+		mask = v.Buf.codeMask(y, y+1)[0]
+	}
+	depth := 0
+	for x := len(line) - 1; x >= 0; x-- {
+		if !mask[x] {
+			continue
+		}
+		for _, bp := range bracePairs {
+			switch line[x] {
+			case bp[1]:
+				depth++
+			case bp[0]:
+				if depth > 0 {
+					depth--
+					continue
+				}
+				var match Loc
+				var ok bool
+				if idx != nil {
+					match, ok = idx.matches[Loc{x, y}]
+				} else {
+					match, ok = v.FindMatchingBrace(Loc{x, y})
+				}
+				if !ok || match.Y <= y {
+					return 0, 0, false
+				}
+				end := match.Y
+				if strings.HasPrefix(strings.TrimSpace(v.Buf.Line(end)), string(bp[1])) {
+					end--
+				}
+				return y, end, end > y
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// indentRange returns the lines after line y that are indented more than it
+func (b *Buffer) indentRange(y int) (int, int, bool) {
+	line := b.Line(y)
+	if IsStrWhitespace(line) {
+		return 0, 0, false
+	}
+	indent := StringWidth(GetLeadingWhitespace(line), b.IntOption("tabsize"))
+	end := y
+	for next := y + 1; next < b.NumLines; next++ {
+		l := b.Line(next)
+		if IsStrWhitespace(l) {
+			continue
+		}
+		if StringWidth(GetLeadingWhitespace(l), b.IntOption("tabsize")) <= indent {
+			break
+		}
+		end = next
+	}
+	return y, end, end > y
+}
+
+// foldRange returns the range of lines that a fold starting at line y would
+// cover, using the method given by the foldmethod option. brackets may hold
+// the buffer's brackets paired up in advance
+func (v *View) foldRange(y int, brackets *bracketIndex) (int, int, bool) {
+	method := v.Buf.StringOption("foldmethod")
+	if method == "markers" || method == "auto" {
+		if start, end, ok := v.Buf.regionRange(y); ok || method == "markers" {
+			return start, end, ok
+		}
+	}
+	if method == "brackets" || method == "auto" {
+		if start, end, ok := v.bracketRange(y, brackets); ok || method == "brackets" {
+			return start, end, ok
+		}
+	}
+	return v.Buf.indentRange(y)
+}
+
+// foldBrackets pairs up the buffer's brackets for folding many lines, or
+// returns nil if the foldmethod option doesn't fold by brackets
+func (v *View) foldBrackets() *bracketIndex {
+	if method := v.Buf.StringOption("foldmethod"); method == "brackets" || method == "auto" {
+		return v.Buf.indexBrackets()
+	}
+	return nil
+}
+
+// enclosingFoldRange returns the smallest fold range that contains line y
+func (v *View) enclosingFoldRange(y int) (int, int, bool) {
+	if start, end, ok := v.foldRange(y, nil); ok {
+		return start, end, ok
+	}
+	brackets := v.foldBrackets()
+	for start := y - 1; start >= 0; start-- {
+		if s, end, ok := v.foldRange(start, brackets); ok && end >= y {
+			return s, end, true
+		}
+	}
+	return 0, 0, false
+}
+
+// foldAt returns the outermost fold that starts at line y
+func (v *View) foldAt(y int) *Fold {
+	var outer *Fold
+	for _, f := range v.folds {
+		if f.start.Y == y && (outer == nil || f.end.Y > outer.end.Y) {
+			outer = f
+		}
+	}
+	return outer
+}
+
+// hiddenBy returns the outermost fold that hides line y, or nil if y is visible
+func (v *View) hiddenBy(y int) *Fold {
+	var outer *Fold
+	for _, f := range v.folds {
+		if f.hides(y) && (outer == nil || f.start.Y < outer.start.Y) {
+			outer = f
+		}
+	}
+	return outer
+}
+
+// visibleLine returns the line that is shown in place of line y: y itself,
+// or the first line of the fold that hides it
+func (v *View) visibleLine(y int) int {
+	if f := v.hiddenBy(y); f != nil {
+		return f.start.Y
+	}
+	return y
+}
+
+// nextVisibleLine returns the first visible line after line y, or before it
+// if dir is negative. It returns y if there is none
+func (v *View) nextVisibleLine(y, dir int) int {
+	next := y + dir
+	if dir < 0 {
+		next = v.visibleLine(next)
+	} else if f := v.foldAt(y); f != nil {
+		next = f.end.Y + 1
+	}
+	if next < 0 || next >= v.Buf.NumLines {
+		return y
+	}
+	return next
+}
+
+// lineAfter returns the line drawn after line y, skipping the lines folded
+// under it
+func (v *View) lineAfter(y int) int {
+	if f := v.foldAt(y); f != nil {
+		return f.end.Y + 1
+	}
+	return y + 1
+}
+
+// addFold folds the lines from start to end
+func (v *View) addFold(start, end int) {
+	if f := v.foldAt(start); f != nil && f.end.Y == end {
+		return
+	}
+	f := &Fold{
+		start: &Anchor{Loc: Loc{0, start}},
+		end:   &Anchor{Loc: Loc{Count(v.Buf.Line(end)), end}, Left: true},
+	}
+	v.Buf.AddAnchor(f.start)
+	v.Buf.AddAnchor(f.end)
+	v.folds = append(v.folds, f)
+}
+
+// removeFold unfolds f
+func (v *View) removeFold(f *Fold) {
+	for i, other := range v.folds {
+		if other == f {
+			v.folds = append(v.folds[:i], v.folds[i+1:]...)
+			break
+		}
+	}
+	v.Buf.RemoveAnchor(f.start)
+	v.Buf.RemoveAnchor(f.end)
+}
+
+// pruneFolds removes the folds whose lines have been deleted, and opens the
+// folds that hide the cursor so that it can be seen
+func (v *View) pruneFolds() {
+	for i := 0; i < len(v.folds); i++ {
+		if f := v.folds[i]; f.end.Y <= f.start.Y {
+			v.removeFold(f)
+			i--
+		}
+	}
+	lines := []int{v.Cursor.Y}
+	if v.Cursor.HasSelection() {
+		lines = append(lines, v.Cursor.CurSelection[0].Y, v.Cursor.CurSelection[1].Y)
+	}
+	for _, y := range lines {
+		for f := v.hiddenBy(y); f != nil; f = v.hiddenBy(y) {
+			v.removeFold(f)
+		}
+	}
+	v.Topline = v.visibleLine(v.Topline)
+}
+
+// Fold folds the code block the cursor is in
+func (v *View) Fold() bool {
+	start, end, ok := v.enclosingFoldRange(v.Cursor.Y)
+	if !ok {
+		return false
+	}
+	v.addFold(start, end)
+	v.Cursor.Loc = Loc{0, start}
+	v.Cursor.ResetSelection()
+
+	return true
+}
+
+// Unfold opens the fold on the cursor's line
+func (v *View) Unfold() bool {
+	f := v.foldAt(v.Cursor.Y)
+	if f == nil {
+		return false
+	}
+	v.removeFold(f)
+
+	return true
+}
+
+// ToggleFold folds the code block the cursor is in, or opens the fold on the
+// cursor's line
+func (v *View) ToggleFold() bool {
+	if v.foldAt(v.Cursor.Y) != nil {
+		return v.Unfold()
+	}
+	return v.Fold()
+}
+
+// FoldAll folds every code block in the buffer
+func (v *View) FoldAll() bool {
+	brackets := v.foldBrackets()
+	for y := 0; y < v.Buf.NumLines; y++ {
+		if start, end, ok := v.foldRange(y, brackets); ok {
+			v.addFold(start, end)
+		}
+	}
+	v.Cursor.Loc = Loc{0, v.visibleLine(v.Cursor.Y)}
+	v.Cursor.ResetSelection()
+
+	return true
+}
+
+// UnfoldAll opens every fold
+func (v *View) UnfoldAll() bool {
+	for len(v.folds) > 0 {
+		v.removeFold(v.folds[0])
+	}
+
+	return true
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// killRingSize is the number of cuts and copies kept in the kill ring
+const killRingSize = 30
+
+var (
+	// The last cuts and copies, most recent last
+	killRing []string
+
+	// Text yanked to the named registers a-z
+	registers = make(map[rune]string)
+)
+
+// pushKill adds text to the kill ring, dropping the oldest entry if it is full
+func pushKill(text string) {
+	if text == "" {
+		return
+	}
+	killRing = append(killRing, text)
+	if len(killRing) > killRingSize {
+		killRing = killRing[len(killRing)-killRingSize:]
+	}
+}
+
+// appendKill appends text to the most recent entry in the kill ring
+func appendKill(text string) {
+	if len(killRing) == 0 {
+		pushKill(text)
+		return
+	}
+	killRing[len(killRing)-1] += text
+}
+
+// lastKill returns the most recent entry in the kill ring
+func lastKill() string {
+	if len(killRing) == 0 {
+		return ""
+	}
+	return killRing[len(killRing)-1]
+}
+
+// killPreview returns a single line preview of a kill ring entry
+func killPreview(text string) string {
+	return strings.Replace(strings.Replace(text, "\t", " ", -1), "\n", "⏎", -1)
+}
+
+// PasteFromHistory lets the user pick an entry of the kill ring and pastes it
+func (v *View) PasteFromHistory() bool {
+	if len(killRing) == 0 {
+		messenger.Alert("nothing has been cut or copied yet")
+		return false
+	}
+
+	options := make([]string, len(killRing))
+	for i := range killRing {
+		options[i] = killPreview(killRing[len(killRing)-1-i])
+	}
+	choice, canceled := messenger.Choose("paste ", options)
+	if canceled {
+		return false
+	}
+	v.paste(killRing[len(killRing)-1-choice])
+
+	return true
+}
+
+// promptRegister asks the user for a register name
+func promptRegister(prompt string) (rune, bool) {
+	input, canceled := messenger.Prompt(prompt, "", "Register")
+	if canceled {
+		return 0, false
+	}
+	reg, ok := parseRegister(input, 0)
+	if !ok || reg == 0 {
+		messenger.Alert("invalid register: ", input)
+		return 0, false
+	}
+	return reg, true
+}
+
+// YankToRegister copies the selection, or the current line if nothing is
+// selected, to a named register
+func (v *View) YankToRegister() bool {
+	reg, ok := promptRegister("yank to register (a-z): ")
+	if !ok {
+		return false
+	}
+	if v.Cursor.HasSelection() {
+		v.Cursor.CopySelection(string(reg))
+	} else {
+		registers[reg] = v.Buf.Line(v.Cursor.Y) + "\n"
+	}
+
+	return false
+}
+
+// PasteFromRegister pastes the contents of a named register
+func (v *View) PasteFromRegister() bool {
+	reg, ok := promptRegister("paste from register (a-z): ")
+	if !ok {
+		return false
+	}
+	text, ok := registers[reg]
+	if !ok {
+		messenger.Alert(fmt.Sprintf("register %c is empty", reg))
+		return false
+	}
+	v.paste(text)
+
+	return true
+}
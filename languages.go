@@ -0,0 +1,108 @@
+package main
+
+import "strings"
+
+// Language describes the bits of a file type's syntax zed knows about
+type Language struct {
+	// Token that starts a comment running to the end of the line
+	LineComment string
+	// Delimiters of a comment that may span several lines
+	BlockComment [2]string
+	// Runes that start and end a string literal
+	Quotes string
+}
+
+// languages maps a file type to its syntax
+var languages = map[string]Language{
+	"go":         {"//", [2]string{"/*", "*/"}, "\"'`"},
+	"c":          {"//", [2]string{"/*", "*/"}, "\"'"},
+	"c++":        {"//", [2]string{"/*", "*/"}, "\"'"},
+	"java":       {"//", [2]string{"/*", "*/"}, "\"'"},
+	"javascript": {"//", [2]string{"/*", "*/"}, "\"'`"},
+	"typescript": {"//", [2]string{"/*", "*/"}, "\"'`"},
+	"rust":       {"//", [2]string{"/*", "*/"}, "\""},
+	"css":        {"", [2]string{"/*", "*/"}, "\"'"},
+	"python":     {"#", [2]string{}, "\"'"},
+	"shell":      {"#", [2]string{}, "\"'"},
+	"ruby":       {"#", [2]string{}, "\"'"},
+	"yaml":       {"#", [2]string{}, "\"'"},
+	"toml":       {"#", [2]string{}, "\"'"},
+	"make":       {"#", [2]string{}, "\"'"},
+	"dockerfile": {"#", [2]string{}, "\"'"},
+	"ini":        {";", [2]string{}, "\""},
+	"lisp":       {";", [2]string{}, "\""},
+	"clojure":    {";", [2]string{}, "\""},
+	"lua":        {"--", [2]string{"--[[", "]]"}, "\"'"},
+	"sql":        {"--", [2]string{"/*", "*/"}, "'"},
+	"haskell":    {"--", [2]string{"{-", "-}"}, "\""},
+	"tex":        {"%", [2]string{}, ""},
+	"vim":        {"\"", [2]string{}, "'"},
+	"html":       {"", [2]string{"<!--", "-->"}, "\"'"},
+	"xml":        {"", [2]string{"<!--", "-->"}, "\"'"},
+	"markdown":   {"", [2]string{"<!--", "-->"}, ""},
+}
+
+// Language returns the syntax of the buffer's file type. ok is false if
+// zed knows nothing about the file type
+func (b *Buffer) Language() (lang Language, ok bool) {
+	lang, ok = languages[b.FileType]
+	return
+}
+
+// codeMask returns, for every line from start to end (exclusive), which runes
+// are code as opposed to being part of a string or a comment.
+// Scanning starts at line start, which is assumed to be outside any
+// block comment. If the file type is unknown every rune counts as code
+func (b *Buffer) codeMask(start, end int) [][]bool {
+	lang, ok := b.Language()
+	mask := make([][]bool, 0, end-start)
+	inBlock := false
+	for lineN := start; lineN < end; lineN++ {
+		line := []rune(b.Line(lineN))
+		m := make([]bool, len(line))
+		var quote rune
+		for x := 0; x < len(line); x++ {
+			if !ok {
+				m[x] = true
+				continue
+			}
+			switch {
+			case inBlock:
+				if runesHavePrefix(line[x:], lang.BlockComment[1]) {
+					inBlock = false
+					x += Count(lang.BlockComment[1]) - 1
+				}
+			case quote != 0:
+				if line[x] == '\\' {
+					x++
+				} else if line[x] == quote {
+					quote = 0
+				}
+			case lang.BlockComment[0] != "" && runesHavePrefix(line[x:], lang.BlockComment[0]):
+				inBlock = true
+				x += Count(lang.BlockComment[0]) - 1
+			case lang.LineComment != "" && runesHavePrefix(line[x:], lang.LineComment):
+				x = len(line)
+			case strings.ContainsRune(lang.Quotes, line[x]):
+				quote = line[x]
+			default:
+				m[x] = true
+			}
+		}
+		mask = append(mask, m)
+	}
+	return mask
+}
+
+// runesHavePrefix reports whether the runes start with prefix, without
+// converting them to a string
+func runesHavePrefix(runes []rune, prefix string) bool {
+	i := 0
+	for _, r := range prefix {
+		if i >= len(runes) || runes[i] != r {
+			return false
+		}
+		i++
+	}
+	return true
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dgv/zed/tcell"
+)
+
+// defaultMacroRegister is used when no register is given
+const defaultMacroRegister = 'a'
+
+var (
+	// Saved macros by register
+	macros map[rune][]tcell.Event
+
+	// Is a macro being recorded, and to which register
+	recordingMacro bool
+	recordRegister rune
+	recordedEvents []tcell.Event
+
+	// The register that was last recorded or played
+	lastMacroRegister rune = defaultMacroRegister
+
+	// Events of a playing macro that are still waiting to be handled
+	playbackEvents []tcell.Event
+	playingMacro   bool
+
+	// Events put aside while waiting for others, such as the keys typed
+	// while a filter runs. They have been recorded already
+	heldEvents []tcell.Event
+)
+
+// macroEvent is the form a macro's events are persisted in
+type macroEvent struct {
+	Key   tcell.Key     `json:",omitempty"`
+	Mod   tcell.ModMask `json:",omitempty"`
+	Rune  rune          `json:",omitempty"`
+	Paste string        `json:",omitempty"`
+}
+
+// macrosFile returns the path macros are persisted to
+func macrosFile() string {
+	return filepath.Join(ConfigDir(), "macros.json")
+}
+
+// InitMacros loads the macros saved by earlier sessions
+func InitMacros() {
+	macros = make(map[rune][]tcell.Event)
+
+	data, err := ioutil.ReadFile(macrosFile())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			TermMessage("Error reading macros:", err)
+		}
+		return
+	}
+	var saved map[string][]macroEvent
+	if err := json.Unmarshal(data, &saved); err != nil {
+		TermMessage("Error reading macros:", err)
+		return
+	}
+	for reg, evs := range saved {
+		r := []rune(reg)
+		if len(r) != 1 {
+			continue
+		}
+		macro := make([]tcell.Event, 0, len(evs))
+		for _, e := range evs {
+			if e.Paste != "" {
+				macro = append(macro, tcell.NewEventPaste(e.Paste))
+			} else {
+				macro = append(macro, tcell.NewEventKey(e.Key, e.Rune, e.Mod))
+			}
+		}
+		macros[r[0]] = macro
+	}
+}
+
+// saveMacros persists all macros to disk
+func saveMacros() error {
+	saved := make(map[string][]macroEvent)
+	for reg, macro := range macros {
+		evs := make([]macroEvent, 0, len(macro))
+		for _, event := range macro {
+			switch e := event.(type) {
+			case *tcell.EventKey:
+				evs = append(evs, macroEvent{Key: e.Key(), Mod: e.Modifiers(), Rune: e.Rune()})
+			case *tcell.EventPaste:
+				evs = append(evs, macroEvent{Paste: e.Text()})
+			}
+		}
+		saved[string(reg)] = evs
+	}
+	data, err := json.MarshalIndent(saved, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(ConfigDir(), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(macrosFile(), data, 0644)
+}
+
+// nextEvent waits for the next event to handle. Events of a playing macro
+// come first, then the events that were held. Key and paste events are
+// recorded if a macro is being recorded
+func nextEvent() tcell.Event {
+	if len(playbackEvents) > 0 {
+		event := playbackEvents[0]
+		playbackEvents = playbackEvents[1:]
+		return event
+	}
+	if len(heldEvents) > 0 {
+		event := heldEvents[0]
+		heldEvents = heldEvents[1:]
+		return event
+	}
+	event := <-events
+	recordEvent(event)
+	return event
+}
+
+// pollEvent is like nextEvent but returns nil instead of waiting if there
+// is no event
+func pollEvent() tcell.Event {
+	if len(playbackEvents) > 0 || len(heldEvents) > 0 {
+		return nextEvent()
+	}
+	select {
+	case event := <-events:
+		recordEvent(event)
+		return event
+	default:
+		return nil
+	}
+}
+
+// holdEvent records an event read from the events channel and puts it aside
+// to be handled after the events held before it
+func holdEvent(event tcell.Event) {
+	recordEvent(event)
+	heldEvents = append(heldEvents, event)
+}
+
+func recordEvent(event tcell.Event) {
+	if !recordingMacro {
+		return
+	}
+	switch event.(type) {
+	case *tcell.EventKey, *tcell.EventPaste:
+		recordedEvents = append(recordedEvents, event)
+	}
+}
+
+// parseRegister returns the register named by str, which must be a single
+// letter from a to z. An empty string names the default register
+func parseRegister(str string, def rune) (rune, bool) {
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return def, true
+	}
+	r := []rune(strings.ToLower(str))
+	if len(r) != 1 || r[0] < 'a' || r[0] > 'z' {
+		return 0, false
+	}
+	return r[0], true
+}
+
+// StartRecordMacro asks for a register and starts recording the events
+// that follow into it
+func (v *View) StartRecordMacro() bool {
+	if recordingMacro {
+		messenger.Alert("already recording a macro")
+		return false
+	}
+	input, canceled := messenger.Prompt("record macro to register (a-z): ", "", "MacroRegister")
+	if canceled {
+		return false
+	}
+	reg, ok := parseRegister(input, defaultMacroRegister)
+	if !ok {
+		messenger.Alert("invalid register: ", input)
+		return false
+	}
+
+	recordRegister = reg
+	recordedEvents = nil
+	recordingMacro = true
+
+	return false
+}
+
+// StopRecordMacro stops recording and saves the macro to its register
+func (v *View) StopRecordMacro() bool {
+	if !recordingMacro {
+		return false
+	}
+	recordingMacro = false
+
+	// The keys that stopped the recording are not part of the macro
+	recordedEvents = recordedEvents[:len(recordedEvents)-Min(actionKeys, len(recordedEvents))]
+	macros[recordRegister] = recordedEvents
+	lastMacroRegister = recordRegister
+	recordedEvents = nil
+
+	if err := saveMacros(); err != nil {
+		messenger.Alert("could not save macros: ", err)
+	}
+
+	return false
+}
+
+// PlayMacro asks for a register and an optional repeat count, such as "a 3",
+// and replays the macro saved in the register. All changes the macro makes
+// to the buffer are undone at once
+func (v *View) PlayMacro() bool {
+	if playingMacro || recordingMacro {
+		return false
+	}
+	input, canceled := messenger.Prompt("play macro (register [count]): ", string(lastMacroRegister), "PlayMacro")
+	if canceled {
+		return false
+	}
+
+	reg, count := lastMacroRegister, 1
+	args := strings.Fields(input)
+	if len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			// Only a count was given
+			args = append([]string{""}, args...)
+			count = n
+		}
+		var ok bool
+		if reg, ok = parseRegister(args[0], lastMacroRegister); !ok {
+			messenger.Alert("invalid register: ", args[0])
+			return false
+		}
+	}
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			messenger.Alert("invalid count: ", args[1])
+			return false
+		}
+		count = n
+	}
+
+	macro, ok := macros[reg]
+	if !ok || len(macro) == 0 {
+		messenger.Alert("register ", string(reg), " holds no macro")
+		return false
+	}
+	lastMacroRegister = reg
+
+	for i := 0; i < count; i++ {
+		playbackEvents = append(playbackEvents, macro...)
+	}
+
+	buf := v.Buf
+	buf.BeginGroup()
+	playingMacro = true
+	for len(playbackEvents) > 0 {
+		HandleEvent(nextEvent())
+	}
+	playingMacro = false
+	buf.EndGroup()
+
+	return true
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// bookmarkMarker is drawn in the gutter next to bookmarked lines
+const bookmarkMarker = '•'
+
+// maxJumps is the number of positions kept in the jump list
+const maxJumps = 100
+
+// savedMarks is the form a buffer's marks and bookmarks are persisted in
+type savedMarks struct {
+	Marks     map[string]Loc `json:",omitempty"`
+	Bookmarks []int          `json:",omitempty"`
+}
+
+// marksFile returns the path marks are persisted to
+func marksFile() string {
+	return filepath.Join(ConfigDir(), "marks.json")
+}
+
+// readMarksFile returns the marks saved for every file
+func readMarksFile() (map[string]savedMarks, error) {
+	saved := make(map[string]savedMarks)
+	data, err := ioutil.ReadFile(marksFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return saved, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(data, &saved)
+	return saved, err
+}
+
+// clampLoc moves loc into the bounds of the buffer
+func (b *Buffer) clampLoc(loc Loc) Loc {
+	loc.Y = Max(0, Min(loc.Y, b.NumLines-1))
+	loc.X = Max(0, Min(loc.X, Count(b.Line(loc.Y))))
+	return loc
+}
+
+// loadMarks restores the marks and bookmarks saved for the buffer's file
+func (b *Buffer) loadMarks() {
+	if b.Path == "" {
+		return
+	}
+	saved, err := readMarksFile()
+	if err != nil {
+		TermMessage("Error reading marks:", err)
+		return
+	}
+	path, _ := filepath.Abs(b.Path)
+	for name, loc := range saved[path].Marks {
+		if reg, ok := parseRegister(name, 0); ok && reg != 0 {
+			b.setMark(reg, b.clampLoc(loc))
+		}
+	}
+	for _, y := range saved[path].Bookmarks {
+		if y >= 0 && y < b.NumLines && !b.IsBookmarked(y) {
+			b.addBookmark(y)
+		}
+	}
+}
+
+// saveMarks persists the marks and bookmarks of the buffer's file
+func (b *Buffer) saveMarks() error {
+	if b.Path == "" {
+		return nil
+	}
+	saved, err := readMarksFile()
+	if err != nil {
+		return err
+	}
+
+	var s savedMarks
+	if len(b.marks) > 0 {
+		s.Marks = make(map[string]Loc)
+		for reg, a := range b.marks {
+			s.Marks[string(reg)] = a.Loc
+		}
+	}
+	s.Bookmarks = b.Bookmarks()
+
+	path, _ := filepath.Abs(b.Path)
+	if s.Marks == nil && s.Bookmarks == nil {
+		delete(saved, path)
+	} else {
+		saved[path] = s
+	}
+
+	data, err := json.MarshalIndent(saved, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(ConfigDir(), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(marksFile(), data, 0644)
+}
+
+// marksChanged persists the marks if the buffer matches its file. Otherwise
+// they are persisted when the buffer is saved, so they don't point into
+// text that was never written
+func (b *Buffer) marksChanged() {
+	if b.IsModified {
+		return
+	}
+	if err := b.saveMarks(); err != nil {
+		messenger.Alert("could not save marks: ", err)
+	}
+}
+
+// setMark puts mark reg at loc
+func (b *Buffer) setMark(reg rune, loc Loc) {
+	if a, ok := b.marks[reg]; ok {
+		a.Loc = loc
+		return
+	}
+	a := &Anchor{Loc: loc, Left: true}
+	b.AddAnchor(a)
+	b.marks[reg] = a
+}
+
+// IsBookmarked returns whether line y has a bookmark
+func (b *Buffer) IsBookmarked(y int) bool {
+	for _, a := range b.bookmarks {
+		if a.Y == y {
+			return true
+		}
+	}
+	return false
+}
+
+// Bookmarks returns the bookmarked lines in order
+func (b *Buffer) Bookmarks() []int {
+	var lines []int
+	for _, a := range b.bookmarks {
+		lines = append(lines, a.Y)
+	}
+	sort.Ints(lines)
+
+	// Bookmarks end up on the same line when the lines between them are removed
+	unique := lines[:0]
+	for i, y := range lines {
+		if i == 0 || y != lines[i-1] {
+			unique = append(unique, y)
+		}
+	}
+	return unique
+}
+
+func (b *Buffer) addBookmark(y int) {
+	a := &Anchor{Loc: Loc{0, y}}
+	b.AddAnchor(a)
+	b.bookmarks = append(b.bookmarks, a)
+}
+
+// ToggleBookmark bookmarks the cursor's line, or removes its bookmark
+func (v *View) ToggleBookmark() bool {
+	b := v.Buf
+	if !b.IsBookmarked(v.Cursor.Y) {
+		b.addBookmark(v.Cursor.Y)
+	} else {
+		for i := 0; i < len(b.bookmarks); i++ {
+			if a := b.bookmarks[i]; a.Y == v.Cursor.Y {
+				b.RemoveAnchor(a)
+				b.bookmarks = append(b.bookmarks[:i], b.bookmarks[i+1:]...)
+				i--
+			}
+		}
+	}
+	b.marksChanged()
+
+	return false
+}
+
+// gotoLine records a jump and moves the cursor to the start of line y
+func (v *View) gotoLine(y int) {
+	v.recordJump()
+	v.Cursor.ResetSelection()
+	v.Cursor.Loc = Loc{0, y}
+	v.Cursor.LastVisualX = 0
+}
+
+// NextBookmark moves the cursor to the next bookmarked line, wrapping around
+// at the end of the buffer
+func (v *View) NextBookmark() bool {
+	lines := v.Buf.Bookmarks()
+	if len(lines) == 0 {
+		return false
+	}
+	target := lines[0]
+	for _, y := range lines {
+		if y > v.Cursor.Y {
+			target = y
+			break
+		}
+	}
+	v.gotoLine(target)
+
+	return true
+}
+
+// PreviousBookmark moves the cursor to the previous bookmarked line,
+// wrapping around at the start of the buffer
+func (v *View) PreviousBookmark() bool {
+	lines := v.Buf.Bookmarks()
+	if len(lines) == 0 {
+		return false
+	}
+	target := lines[len(lines)-1]
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i] < v.Cursor.Y {
+			target = lines[i]
+			break
+		}
+	}
+	v.gotoLine(target)
+
+	return true
+}
+
+// ListBookmarks lets the user pick a bookmarked line and moves there
+func (v *View) ListBookmarks() bool {
+	lines := v.Buf.Bookmarks()
+	if len(lines) == 0 {
+		messenger.Alert("no bookmarks in this buffer")
+		return false
+	}
+	options := make([]string, len(lines))
+	for i, y := range lines {
+		options[i] = fmt.Sprintf("%d: %s", y+1, killPreview(v.Buf.Line(y)))
+	}
+	choice, canceled := messenger.Choose("bookmark ", options)
+	if canceled {
+		return false
+	}
+	v.gotoLine(lines[choice])
+
+	return true
+}
+
+// SetMark asks for a mark name and puts the mark at the cursor
+func (v *View) SetMark() bool {
+	reg, ok := promptRegister("set mark (a-z): ")
+	if !ok {
+		return false
+	}
+	v.Buf.setMark(reg, v.Cursor.Loc)
+	v.Buf.marksChanged()
+
+	return false
+}
+
+// JumpToMark asks for a mark name and moves the cursor to the mark
+func (v *View) JumpToMark() bool {
+	reg, ok := promptRegister("jump to mark (a-z): ")
+	if !ok {
+		return false
+	}
+	a, ok := v.Buf.marks[reg]
+	if !ok {
+		messenger.Alert(fmt.Sprintf("mark %c is not set", reg))
+		return false
+	}
+	v.recordJump()
+	v.Cursor.ResetSelection()
+	v.Cursor.Loc = a.Loc
+	v.Cursor.LastVisualX = v.Cursor.GetVisualX()
+
+	return true
+}
+
+// jump is a position in the jump list
+type jump struct {
+	buf *Buffer
+	loc *Anchor
+}
+
+// dropJumps forgets the jumps from index i on
+func (v *View) dropJumps(i int) {
+	for _, j := range v.jumps[i:] {
+		j.buf.RemoveAnchor(j.loc)
+	}
+	v.jumps = v.jumps[:i]
+}
+
+// recordJump adds the cursor's position to the jump list, forgetting the
+// jumps that were gone back over. Call it before moving the cursor far
+func (v *View) recordJump() {
+	if v.jumping || v.Buf == nil {
+		return
+	}
+	v.dropJumps(v.jumpIndex)
+	if n := len(v.jumps); n > 0 && v.jumps[n-1].buf == v.Buf && v.jumps[n-1].loc.Y == v.Cursor.Y {
+		// Only one jump is kept per line
+		v.dropJumps(n - 1)
+	}
+	a := &Anchor{Loc: v.Cursor.Loc, Left: true}
+	v.Buf.AddAnchor(a)
+	v.jumps = append(v.jumps, jump{v.Buf, a})
+	if len(v.jumps) > maxJumps {
+		v.jumps[0].buf.RemoveAnchor(v.jumps[0].loc)
+		v.jumps = v.jumps[1:]
+	}
+	v.jumpIndex = len(v.jumps)
+}
+
+// goToJump moves the cursor to jump i, opening its file if it is in another
+// buffer
+func (v *View) goToJump(i int) bool {
+	j := v.jumps[i]
+	if j.buf != v.Buf {
+		if !v.CanClose() {
+			return false
+		}
+		v.jumping = true
+		if j.buf.Path == "" {
+			v.OpenBuffer(j.buf)
+		} else {
+			v.Open(j.buf.Path)
+		}
+		v.jumping = false
+		if v.Buf.Path != j.buf.Path {
+			return false
+		}
+		// The file was opened into a new buffer, which the jumps should follow
+		for k := range v.jumps {
+			if v.jumps[k].buf == j.buf {
+				j.buf.RemoveAnchor(v.jumps[k].loc)
+				v.jumps[k].buf = v.Buf
+				v.jumps[k].loc.Loc = v.Buf.clampLoc(v.jumps[k].loc.Loc)
+				v.Buf.AddAnchor(v.jumps[k].loc)
+			}
+		}
+	}
+	v.jumpIndex = i
+	v.Cursor.ResetSelection()
+	v.Cursor.Loc = v.Buf.clampLoc(j.loc.Loc)
+	v.Cursor.LastVisualX = v.Cursor.GetVisualX()
+	return true
+}
+
+// JumpBack moves the cursor to where it was before the last jump
+func (v *View) JumpBack() bool {
+	if v.jumpIndex == len(v.jumps) {
+		// Remember where we are so JumpForward can come back
+		v.recordJump()
+		v.jumpIndex = len(v.jumps) - 1
+	}
+	if v.jumpIndex <= 0 {
+		return false
+	}
+	return v.goToJump(v.jumpIndex - 1)
+}
+
+// JumpForward undoes a JumpBack
+func (v *View) JumpForward() bool {
+	if v.jumpIndex >= len(v.jumps)-1 {
+		return false
+	}
+	return v.goToJump(v.jumpIndex + 1)
+}
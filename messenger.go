@@ -7,8 +7,9 @@ import (
 	"os"
 	"path"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
-	"github.com/dgv/clipboard"
 	"github.com/dgv/zed/runewidth"
 	"github.com/dgv/zed/tcell"
 )
@@ -104,7 +105,7 @@ func (m *Messenger) Alert(msg ...interface{}) bool {
 		m.Display()
 		screen.ShowCursor(Count(m.message), h-1)
 		screen.Show()
-		event := <-events
+		event := nextEvent()
 
 		switch e := event.(type) {
 		case *tcell.EventKey:
@@ -130,7 +131,7 @@ func (m *Messenger) YesNoPrompt(prompt string) (bool, bool) {
 		m.Display()
 		screen.ShowCursor(Count(m.message), h-1)
 		screen.Show()
-		event := <-events
+		event := nextEvent()
 
 		switch e := event.(type) {
 		case *tcell.EventKey:
@@ -164,7 +165,7 @@ func (m *Messenger) YesNoAllPrompt(prompt string) (rune, bool) {
 		m.Display()
 		screen.ShowCursor(Count(m.message), h-1)
 		screen.Show()
-		event := <-events
+		event := nextEvent()
 
 		switch e := event.(type) {
 		case *tcell.EventKey:
@@ -191,9 +192,54 @@ func (m *Messenger) YesNoAllPrompt(prompt string) (rune, bool) {
 	}
 }
 
+// Choose shows the options one at a time, letting the user move through them
+// with the arrow keys and pick one with enter. It returns the index of the
+// chosen option and whether the user canceled
+func (m *Messenger) Choose(prompt string, options []string) (int, bool) {
+	m.hasPrompt = true
+	choice := 0
+
+	_, h := screen.Size()
+	for {
+		m.PromptText(fmt.Sprintf("%s(%d/%d, up/down, enter): %s", prompt, choice+1, len(options), options[choice]))
+		m.Clear()
+		m.Display()
+		screen.ShowCursor(Count(m.message), h-1)
+		screen.Show()
+		event := nextEvent()
+
+		switch e := event.(type) {
+		case *tcell.EventKey:
+			switch e.Key() {
+			case tcell.KeyUp, tcell.KeyLeft:
+				if choice > 0 {
+					choice--
+				}
+			case tcell.KeyDown, tcell.KeyRight:
+				if choice < len(options)-1 {
+					choice++
+				}
+			case tcell.KeyEnter:
+				m.Clear()
+				m.Reset()
+				return choice, false
+			case tcell.KeyCtrlC, tcell.KeyCtrlQ, tcell.KeyEscape:
+				m.Clear()
+				m.Reset()
+				return 0, true
+			}
+		}
+	}
+}
+
+// A Completer returns the completions of the last of the arguments typed
+// into a prompt so far
+type Completer func(args []string) []string
+
 // Prompt sends the user a message and waits for a response to be typed in
 // This function blocks the main loop while waiting for input
-func (m *Messenger) Prompt(prompt, placeholder, historyType string) (string, bool) {
+// If a completer is given, tab completes the argument before the cursor
+func (m *Messenger) Prompt(prompt, placeholder, historyType string, completer ...Completer) (string, bool) {
 	m.hasPrompt = true
 	m.PromptText(prompt)
 	if _, ok := m.history[historyType]; !ok {
@@ -212,7 +258,7 @@ func (m *Messenger) Prompt(prompt, placeholder, historyType string) (string, boo
 		var suggestions []string
 		m.Clear()
 
-		event := <-events
+		event := nextEvent()
 
 		switch e := event.(type) {
 		case *tcell.EventKey:
@@ -225,6 +271,10 @@ func (m *Messenger) Prompt(prompt, placeholder, historyType string) (string, boo
 				m.hasPrompt = false
 				response, canceled = m.response, false
 				m.history[historyType][len(m.history[historyType])-1] = response
+			case tcell.KeyTab:
+				if len(completer) > 0 {
+					suggestions = m.complete(completer[0])
+				}
 			}
 		}
 
@@ -249,53 +299,42 @@ func (m *Messenger) HandleEvent(event tcell.Event, history []string) {
 	switch e := event.(type) {
 	case *tcell.EventKey:
 		if e.Key() != tcell.KeyRune || e.Modifiers() != 0 {
-			for key, actions := range bindings {
-				if e.Key() == key.keyCode {
-					if e.Key() == tcell.KeyRune {
-						if e.Rune() != key.r {
-							continue
-						}
+			for _, action := range bindings.lookup(keyOf(e)) {
+				funcName := FuncName(action)
+				switch funcName {
+				case "main.(*View).CursorUp":
+					if m.historyNum > 0 {
+						m.historyNum--
+						m.response = history[m.historyNum]
+						m.cursorx = Count(m.response)
+					}
+				case "main.(*View).CursorDown":
+					if m.historyNum < len(history)-1 {
+						m.historyNum++
+						m.response = history[m.historyNum]
+						m.cursorx = Count(m.response)
+					}
+				case "main.(*View).CursorLeft":
+					if m.cursorx > 0 {
+						m.cursorx--
 					}
-					if e.Modifiers() == key.modifiers {
-						for _, action := range actions {
-							funcName := FuncName(action)
-							switch funcName {
-							case "main.(*View).CursorUp":
-								if m.historyNum > 0 {
-									m.historyNum--
-									m.response = history[m.historyNum]
-									m.cursorx = Count(m.response)
-								}
-							case "main.(*View).CursorDown":
-								if m.historyNum < len(history)-1 {
-									m.historyNum++
-									m.response = history[m.historyNum]
-									m.cursorx = Count(m.response)
-								}
-							case "main.(*View).CursorLeft":
-								if m.cursorx > 0 {
-									m.cursorx--
-								}
-							case "main.(*View).CursorRight":
-								if m.cursorx < Count(m.response) {
-									m.cursorx++
-								}
-							case "main.(*View).CursorStart", "main.(*View).StartOfLine":
-								m.cursorx = 0
-							case "main.(*View).CursorEnd", "main.(*View).EndOfLine":
-								m.cursorx = Count(m.response)
-							case "main.(*View).Backspace":
-								if m.cursorx > 0 {
-									m.response = string([]rune(m.response)[:m.cursorx-1]) + string([]rune(m.response)[m.cursorx:])
-									m.cursorx--
-								}
-							case "main.(*View).Paste":
-								clip, _ := clipboard.ReadAll()
-								m.response = Insert(m.response, m.cursorx, clip)
-								m.cursorx += Count(clip)
-							}
-						}
+				case "main.(*View).CursorRight":
+					if m.cursorx < Count(m.response) {
+						m.cursorx++
 					}
+				case "main.(*View).CursorStart", "main.(*View).StartOfLine":
+					m.cursorx = 0
+				case "main.(*View).CursorEnd", "main.(*View).EndOfLine":
+					m.cursorx = Count(m.response)
+				case "main.(*View).Backspace":
+					if m.cursorx > 0 {
+						m.response = string([]rune(m.response)[:m.cursorx-1]) + string([]rune(m.response)[m.cursorx:])
+						m.cursorx--
+					}
+				case "main.(*View).Paste":
+					clip := ReadClipboard()
+					m.response = Insert(m.response, m.cursorx, clip)
+					m.cursorx += Count(clip)
 				}
 			}
 		}
@@ -313,6 +352,47 @@ func (m *Messenger) HandleEvent(event tcell.Event, history []string) {
 	}
 }
 
+// complete completes the argument before the cursor in the response as far
+// as its completions agree, and returns them if there are several
+func (m *Messenger) complete(completer Completer) []string {
+	before := []rune(m.response)[:m.cursorx]
+	args := SplitCommandArgs(string(before))
+	suggestions := completer(args)
+	if len(suggestions) == 0 {
+		return nil
+	}
+
+	// The argument starts after the last space, unless it was quoted
+	last := args[len(args)-1]
+	start := len(before) - Count(last)
+	if start < 0 || string(before[start:]) != last {
+		start = strings.LastIndex(string(before), " ") + 1
+		start = Count(string(before)[:start])
+	}
+
+	completion := suggestions[0]
+	for _, s := range suggestions[1:] {
+		for !strings.HasPrefix(s, completion) {
+			_, size := utf8.DecodeLastRuneInString(completion)
+			completion = completion[:len(completion)-size]
+		}
+	}
+	text := JoinCommandArgs(completion)
+	if len(suggestions) == 1 && !strings.HasSuffix(completion, "/") {
+		text += " "
+	}
+	if completion == "" {
+		text = string(before[start:])
+	}
+
+	m.response = string(before[:start]) + text + string([]rune(m.response)[m.cursorx:])
+	m.cursorx = start + Count(text)
+	if len(suggestions) == 1 {
+		return nil
+	}
+	return suggestions
+}
+
 // Reset resets the messenger's cursor, message and response
 func (m *Messenger) Reset() {
 	m.cursorx = 0
@@ -376,7 +456,17 @@ func (m *Messenger) Display() {
 		if v.Buf.IsModified {
 			modified = "*"
 		}
-		runes := []rune(fmt.Sprintf(" %s%s (%d,%d)", modified, path.Base(v.Buf.GetName()), v.Cursor.Y+1, v.Cursor.GetVisualX()+1))
+		status := fmt.Sprintf(" %s%s (%d,%d)", modified, path.Base(v.Buf.GetName()), v.Cursor.Y+1, v.Cursor.GetVisualX()+1)
+		if recordingMacro {
+			status += fmt.Sprintf(" recording @%c", recordRegister)
+		}
+		if len(pendingKeys) > 0 {
+			status += " " + pendingKeysString()
+		}
+		if viEnabled() {
+			status += " " + v.vi.status()
+		}
+		runes := []rune(status)
 		for x := 0; x < len(runes); x++ {
 			screen.SetContent(x, h, runes[x], nil, m.style)
 		}
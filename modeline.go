@@ -0,0 +1,178 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// modelineLines is how many lines at the start and the end of a file are
+// searched for modelines
+const modelineLines = 5
+
+var (
+	vimModelineRegex   = regexp.MustCompile(`(?:^|\s)(?:vi|vim|Vim|ex)(?:[<=>]?\d+)?:\s*(.*)$`)
+	emacsModelineRegex = regexp.MustCompile(`-\*-(.*?)-\*-`)
+)
+
+// A modeline holds the settings found in the modelines of a file. Only
+// settings that can't do harm are read, and sizes out of the range of their
+// options are dropped, everything else is ignored
+type modeline struct {
+	tabWidth   int
+	indentSize int
+	textWidth  int
+	// "true" or "false" if the modeline says whether to indent with spaces
+	expandTab string
+	fileType  string
+}
+
+// parseVimModeline reads a vim modeline, in either the
+// "vim: set ts=8 sw=4 et:" or the "vim: ts=8 sw=4 et" form
+func (m *modeline) parseVimModeline(line string) {
+	match := vimModelineRegex.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	text := match[1]
+	var opts []string
+	if strings.HasPrefix(text, "set ") || strings.HasPrefix(text, "se ") {
+		// The options end at the first colon that isn't escaped
+		text = text[strings.Index(text, " "):]
+		end := 0
+		for end < len(text) && (text[end] != ':' || (end > 0 && text[end-1] == '\\')) {
+			end++
+		}
+		if end == len(text) {
+			return
+		}
+		opts = strings.Fields(text[:end])
+	} else {
+		opts = strings.FieldsFunc(text, func(r rune) bool {
+			return r == ':' || r == ' ' || r == '\t'
+		})
+	}
+
+	for _, opt := range opts {
+		name, value := opt, ""
+		if eq := strings.Index(opt, "="); eq >= 0 {
+			name, value = opt[:eq], opt[eq+1:]
+		}
+		n, _ := strconv.Atoi(value)
+		switch name {
+		case "ts", "tabstop":
+			if validInt("tabsize", n) {
+				m.tabWidth = n
+			}
+		case "sw", "shiftwidth", "sts", "softtabstop":
+			if validInt("tabsize", n) {
+				m.indentSize = n
+			}
+		case "tw", "textwidth":
+			if validInt("textwidth", n) {
+				m.textWidth = n
+			}
+		case "et", "expandtab":
+			m.expandTab = "true"
+		case "noet", "noexpandtab":
+			m.expandTab = "false"
+		case "ft", "filetype", "syn", "syntax":
+			if ft, ok := lookupFileType(value); ok {
+				m.fileType = ft
+			}
+		}
+	}
+}
+
+// parseEmacsModeline reads an emacs "-*- mode: python; tab-width: 4 -*-" or
+// "-*- python -*-" line
+func (m *modeline) parseEmacsModeline(line string) {
+	match := emacsModelineRegex.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	text := strings.TrimSpace(match[1])
+	if !strings.Contains(text, ":") {
+		text = "mode: " + text
+	}
+
+	for _, v := range strings.Split(text, ";") {
+		colon := strings.Index(v, ":")
+		if colon < 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(v[:colon]))
+		value := strings.TrimSpace(v[colon+1:])
+		n, _ := strconv.Atoi(value)
+		switch {
+		case name == "mode":
+			if ft, ok := lookupFileType(strings.TrimSuffix(strings.ToLower(value), "-mode")); ok {
+				m.fileType = ft
+			}
+		case name == "tab-width":
+			if validInt("tabsize", n) {
+				m.tabWidth = n
+			}
+		case name == "fill-column":
+			if validInt("textwidth", n) {
+				m.textWidth = n
+			}
+		case name == "indent-tabs-mode":
+			if value == "nil" {
+				m.expandTab = "true"
+			} else if value == "t" {
+				m.expandTab = "false"
+			}
+		case strings.HasSuffix(name, "-basic-offset"), strings.HasSuffix(name, "-indent-offset"), strings.HasSuffix(name, "-indent-level"):
+			if validInt("tabsize", n) {
+				m.indentSize = n
+			}
+		}
+	}
+}
+
+// settings returns the options the modeline sets
+func (m *modeline) settings() map[string]string {
+	settings := make(map[string]string)
+	if m.expandTab != "" {
+		settings["tabstospaces"] = m.expandTab
+	}
+	// As with .editorconfig files, the indent size wins when indenting with
+	// spaces, and the tab width otherwise
+	size := m.tabWidth
+	if size <= 0 || (m.indentSize > 0 && m.expandTab == "true") {
+		size = m.indentSize
+	}
+	if size > 0 {
+		settings["tabsize"] = strconv.Itoa(size)
+	}
+	if m.textWidth > 0 {
+		settings["textwidth"] = strconv.Itoa(m.textWidth)
+	}
+	return settings
+}
+
+// applyModelines sets the buffer's options and file type from the vim
+// modelines in its first and last lines and an emacs one in its first two
+func (b *Buffer) applyModelines() {
+	if !BoolOption("modeline") {
+		return
+	}
+	m := new(modeline)
+	for y := 0; y < b.NumLines && y < modelineLines; y++ {
+		if y < 2 {
+			m.parseEmacsModeline(b.Line(y))
+		}
+		m.parseVimModeline(b.Line(y))
+	}
+	for y := Max(modelineLines, b.NumLines-modelineLines); y < b.NumLines; y++ {
+		m.parseVimModeline(b.Line(y))
+	}
+
+	for name, value := range m.settings() {
+		b.SetLocalOption(name, value, false)
+	}
+	if m.fileType != "" {
+		b.FileType = m.fileType
+	}
+}
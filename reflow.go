@@ -0,0 +1,247 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/dgv/zed/runewidth"
+)
+
+// bulletRegex matches the marker that starts an item of a bulleted or
+// numbered list
+var bulletRegex = regexp.MustCompile(`^([-*+]|[0-9]+[.)])\s+`)
+
+// commentMarkers returns the markers that may start the lines of a paragraph,
+// such as comment leaders and quote markers
+func (b *Buffer) commentMarkers() []string {
+	markers := []string{"//", ">"}
+	if b.FileType != "markdown" {
+		// In markdown # starts a heading, not a comment
+		markers = append(markers, "#")
+	}
+	if lang, ok := b.Language(); ok && lang.LineComment != "" && !Contains(markers, lang.LineComment) {
+		markers = append(markers, lang.LineComment)
+	}
+	return markers
+}
+
+// linePrefix splits the prefix off a line: the leading whitespace followed
+// by any comment or quote markers and the whitespace after them. If the text
+// then starts a list item, its bullet is returned too
+func (b *Buffer) linePrefix(line string) (prefix, bullet string) {
+	markers := b.commentMarkers()
+	n := len(GetLeadingWhitespace(line))
+	for found := true; found; {
+		found = false
+		for _, m := range markers {
+			if strings.HasPrefix(line[n:], m) {
+				n += len(m)
+				n += len(GetLeadingWhitespace(line[n:]))
+				found = true
+			}
+		}
+	}
+	return line[:n], bulletRegex.FindString(line[n:])
+}
+
+// hangingPrefix returns the prefix for the lines that continue a line
+// starting with prefix and bullet: bullets are replaced by spaces so the
+// text lines up
+func hangingPrefix(prefix, bullet string, tabsize int) string {
+	if bullet == "" {
+		return prefix
+	}
+	return prefix + Spaces(StringWidth(prefix+bullet, tabsize)-StringWidth(prefix, tabsize))
+}
+
+// isParagraphBreak returns whether line y is blank apart from its prefix
+func (b *Buffer) isParagraphBreak(y int) bool {
+	line := b.Line(y)
+	prefix, _ := b.linePrefix(line)
+	return IsStrWhitespace(line[len(prefix):])
+}
+
+// sameParagraph returns whether line y continues the paragraph on line y-1
+func (b *Buffer) sameParagraph(y int) bool {
+	if y <= 0 || y >= b.NumLines || b.isParagraphBreak(y-1) || b.isParagraphBreak(y) {
+		return false
+	}
+	prev, _ := b.linePrefix(b.Line(y - 1))
+	prefix, bullet := b.linePrefix(b.Line(y))
+	return bullet == "" && strings.TrimSpace(prev) == strings.TrimSpace(prefix)
+}
+
+// paragraphAt returns the first and last line of the paragraph on line y
+func (b *Buffer) paragraphAt(y int) (int, int) {
+	start, end := y, y
+	for b.sameParagraph(start) {
+		start--
+	}
+	for b.sameParagraph(end + 1) {
+		end++
+	}
+	return start, end
+}
+
+// wrapChunk is a piece of text that lines may not be broken inside of
+type wrapChunk struct {
+	text string
+	// Whether the chunk is separated from the previous one by a space
+	space bool
+}
+
+// wrapChunks splits text into the pieces lines may be broken between. Words
+// are broken at whitespace, and wide characters such as CJK ideographs may
+// be broken between as well
+func wrapChunks(text string) []wrapChunk {
+	var chunks []wrapChunk
+	for _, word := range strings.Fields(text) {
+		space := true
+		var narrow []rune
+		for _, r := range word {
+			if runewidth.RuneWidth(r) < 2 {
+				narrow = append(narrow, r)
+				continue
+			}
+			if len(narrow) > 0 {
+				chunks = append(chunks, wrapChunk{string(narrow), space})
+				narrow, space = nil, false
+			}
+			chunks = append(chunks, wrapChunk{string(r), space})
+			space = false
+		}
+		if len(narrow) > 0 {
+			chunks = append(chunks, wrapChunk{string(narrow), space})
+		}
+	}
+	return chunks
+}
+
+// wrapText fills lines with text so that none is wider than width, unless a
+// single word is. The first line starts with prefix and the others with rest
+func wrapText(text, prefix, rest string, width, tabsize int) []string {
+	var lines []string
+	line := prefix
+	lineWidth := StringWidth(prefix, tabsize)
+	empty := true
+	for _, c := range wrapChunks(text) {
+		w := runewidth.StringWidth(c.text)
+		sep := ""
+		if c.space && !empty {
+			sep = " "
+		}
+		if !empty && lineWidth+len(sep)+w > width {
+			lines = append(lines, line)
+			line, sep = rest, ""
+			lineWidth = StringWidth(rest, tabsize)
+		}
+		line += sep + c.text
+		lineWidth += len(sep) + w
+		empty = false
+	}
+	return append(lines, line)
+}
+
+// reflowLines rewraps the paragraph from line start to line end
+func (v *View) reflowLines(start, end int) {
+	prefix, bullet := v.Buf.linePrefix(v.Buf.Line(start))
+	var words []string
+	for y := start; y <= end; y++ {
+		line := v.Buf.Line(y)
+		p, _ := v.Buf.linePrefix(line)
+		words = append(words, line[len(p):])
+	}
+	text := strings.Join(words, " ")
+	tabsize := v.Buf.IntOption("tabsize")
+	lines := wrapText(text[len(bullet):], prefix+bullet, hangingPrefix(prefix, bullet, tabsize), v.Buf.IntOption("textwidth"), tabsize)
+
+	from, to := Loc{0, start}, Loc{Count(v.Buf.Line(end)), end}
+	if wrapped := strings.Join(lines, "\n"); wrapped != v.Buf.Substr(from, to) {
+		v.Buf.Replace(from, to, wrapped)
+	}
+}
+
+// ReflowParagraph rewraps the paragraph under the cursor, or the paragraphs
+// in the selection, to the text width
+func (v *View) ReflowParagraph() bool {
+	first, last := v.Cursor.Y, v.Cursor.Y
+	if v.Cursor.HasSelection() {
+		first, last = v.Cursor.SelectedLines()
+	}
+
+	// Paragraphs are reflowed from the bottom up so the lines above keep
+	// their numbers
+	var paragraphs [][2]int
+	for y := first; y <= last; y++ {
+		if v.Buf.isParagraphBreak(y) {
+			continue
+		}
+		start, end := v.Buf.paragraphAt(y)
+		if v.Cursor.HasSelection() {
+			start, end = Max(start, first), Min(end, last)
+		}
+		paragraphs = append(paragraphs, [2]int{start, end})
+		y = end
+	}
+	if len(paragraphs) == 0 {
+		return false
+	}
+
+	// The cursor ends up at the end of the last paragraph reflowed
+	last = paragraphs[len(paragraphs)-1][1]
+	end := &Anchor{Loc: Loc{Count(v.Buf.Line(last)), last}}
+	v.Buf.AddAnchor(end)
+	v.Buf.BeginGroup()
+	for i := len(paragraphs) - 1; i >= 0; i-- {
+		v.reflowLines(paragraphs[i][0], paragraphs[i][1])
+	}
+	v.Buf.EndGroup()
+	v.Buf.RemoveAnchor(end)
+
+	v.Cursor.ResetSelection()
+	v.Cursor.Loc = end.Loc
+	v.Cursor.LastVisualX = v.Cursor.GetVisualX()
+
+	return true
+}
+
+// autoWrap breaks the line at the cursor if typing has taken it past the
+// text width. The new line continues the prefix of the old one
+func (v *View) autoWrap() {
+	line := []rune(v.Buf.Line(v.Cursor.Y))
+	tabsize, textwidth := v.Buf.IntOption("tabsize"), v.Buf.IntOption("textwidth")
+	if StringWidth(string(line[:v.Cursor.X]), tabsize) <= textwidth {
+		return
+	}
+	prefix, bullet := v.Buf.linePrefix(string(line))
+	textStart := Count(prefix + bullet)
+
+	// Find the last place before the text width where the line may break:
+	// after whitespace, or next to a wide character
+	brk := -1
+	for i := textStart + 1; i < v.Cursor.X; i++ {
+		if StringWidth(string(line[:i]), tabsize) > textwidth {
+			break
+		}
+		space := unicode.IsSpace(line[i-1]) && !unicode.IsSpace(line[i])
+		wide := runewidth.RuneWidth(line[i-1]) > 1 || runewidth.RuneWidth(line[i]) > 1
+		if space || (wide && !unicode.IsSpace(line[i])) {
+			brk = i
+		}
+	}
+	if brk < 0 {
+		return
+	}
+	spaces := brk
+	for spaces > textStart && unicode.IsSpace(line[spaces-1]) {
+		spaces--
+	}
+
+	cursor := &Anchor{Loc: v.Cursor.Loc}
+	v.Buf.AddAnchor(cursor)
+	v.Buf.Replace(Loc{spaces, v.Cursor.Y}, Loc{brk, v.Cursor.Y}, "\n"+hangingPrefix(prefix, bullet, tabsize))
+	v.Buf.RemoveAnchor(cursor)
+	v.Cursor.Loc = cursor.Loc
+	v.Cursor.LastVisualX = v.Cursor.GetVisualX()
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A runningCommand is a shell command started by RunCommand. Its output is
+// collected as it arrives and added to its buffer by the main loop
+type runningCommand struct {
+	command string
+	buf     *Buffer
+	process *os.Process
+
+	// Guards what follows, which the command's goroutines write
+	lock    sync.Mutex
+	pending []byte
+	done    bool
+	err     error
+}
+
+// commandEvent wakes the main loop up when a running command has printed
+// something or exited
+type commandEvent struct {
+	when time.Time
+}
+
+func (e *commandEvent) When() time.Time {
+	return e.when
+}
+
+// The commands whose output is still being added to their buffers
+var runningCommands []*runningCommand
+
+// RunCommand asks for a shell command and runs it in the background, showing
+// its output in a new read-only buffer as it arrives
+func (v *View) RunCommand() bool {
+	command, canceled := messenger.Prompt("run: ", "", "Run")
+	if canceled || strings.TrimSpace(command) == "" {
+		return false
+	}
+	v.run(command)
+
+	return true
+}
+
+// KillCommand kills the command whose output is in the view, or else the
+// command started last, along with the commands it started
+func (v *View) KillCommand() bool {
+	if len(runningCommands) == 0 {
+		messenger.Alert("no command is running")
+		return false
+	}
+	rc := runningCommands[len(runningCommands)-1]
+	for _, c := range runningCommands {
+		if c.buf == v.Buf {
+			rc = c
+		}
+	}
+	killProcessGroup(rc.process)
+
+	return false
+}
+
+// run starts a shell command in the buffer's directory and opens the buffer
+// its output goes to, asking to save the changes to the buffer it replaces
+func (v *View) run(command string) {
+	if !v.CanClose() {
+		return
+	}
+	cmd := shellCmd(command)
+	if v.Buf.Path != "" {
+		cmd.Dir = filepath.Dir(v.Buf.AbsPath)
+	}
+	r, w := io.Pipe()
+	cmd.Stdout, cmd.Stderr = w, w
+	setProcessGroup(cmd)
+	// Commands that left the process group may hold the output open after
+	// the command was killed, so don't wait long for them
+	cmd.WaitDelay = time.Second
+	if err := cmd.Start(); err != nil {
+		messenger.Alert(err)
+		return
+	}
+
+	buf := NewBufferFromString("$ "+command+"\n", "")
+	buf.name = "run: " + command
+	buf.ReadOnly = true
+	rc := &runningCommand{command: command, buf: buf, process: cmd.Process}
+	runningCommands = append(runningCommands, rc)
+
+	go func() {
+		err := cmd.Wait()
+		rc.lock.Lock()
+		rc.err = err
+		rc.lock.Unlock()
+		w.Close()
+	}()
+	go func() {
+		// The output ends once the command has exited
+		data := make([]byte, 4096)
+		for {
+			n, err := r.Read(data)
+			rc.lock.Lock()
+			rc.pending = append(rc.pending, data[:n]...)
+			rc.done = err != nil
+			rc.lock.Unlock()
+			wakeMainLoop()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	v.OpenBuffer(buf)
+}
+
+// wakeMainLoop makes the main loop add the output of running commands to
+// their buffers. Nothing is sent if the loop has events to handle anyway
+func wakeMainLoop() {
+	if events == nil {
+		return
+	}
+	select {
+	case events <- &commandEvent{time.Now()}:
+	default:
+	}
+}
+
+// updateCommands adds the output that arrived from running commands to their
+// buffers, a line at a time. The cursor follows the output if it was at the
+// end of the buffer
+func updateCommands() {
+	running := runningCommands[:0]
+	for _, rc := range runningCommands {
+		rc.lock.Lock()
+		done, err := rc.done, rc.err
+		n := len(rc.pending)
+		if !done {
+			n = bytes.LastIndexByte(rc.pending, '\n') + 1
+		}
+		text := string(rc.pending[:n])
+		rc.pending = rc.pending[n:]
+		rc.lock.Unlock()
+
+		if done {
+			if err != nil {
+				text += "[" + err.Error() + "]\n"
+			} else {
+				text += "[done]\n"
+			}
+		} else {
+			running = append(running, rc)
+		}
+		if text != "" {
+			rc.buf.appendOutput(text)
+		}
+	}
+	runningCommands = running
+}
+
+// appendOutput adds text to the end of the buffer without making it count as
+// a change
+func (b *Buffer) appendOutput(text string) {
+	follow := b.Cursor.Loc == b.End()
+	b.insert(b.End(), []byte(text))
+	b.IsModified = false
+	if follow {
+		b.Cursor.Loc = b.End()
+		b.Cursor.LastVisualX = b.Cursor.GetVisualX()
+	}
+}
@@ -16,6 +16,9 @@ var (
 	// Is there currently a search in progress
 	searching bool
 
+	// Does the search in progress go down the buffer
+	searchDown = true
+
 	// Stores the history for searching
 	searchHistory []string
 )
@@ -56,7 +59,7 @@ func HandleSearchEvent(event tcell.Event, v *View) {
 	switch e := event.(type) {
 	case *tcell.EventKey:
 		switch e.Key() {
-		case tcell.KeyEscape:
+		case tcell.KeyEscape, tcell.KeyCtrlG:
 			// Exit the search mode
 			ExitSearch(v)
 			return
@@ -64,6 +67,19 @@ func HandleSearchEvent(event tcell.Event, v *View) {
 			// Done
 			EndSearch()
 			return
+		case tcell.KeyCtrlS, tcell.KeyCtrlR:
+			// Go on to the next or previous match without ending the search
+			searchDown = e.Key() == tcell.KeyCtrlS
+			if v.Cursor.HasSelection() {
+				if searchDown {
+					searchStart = ToCharPos(v.Cursor.CurSelection[1], v.Buf)
+				} else {
+					searchStart = ToCharPos(v.Cursor.CurSelection[0], v.Buf)
+				}
+			}
+			Search(messenger.response, v, searchDown)
+			v.Relocate()
+			return
 		}
 	}
 
@@ -81,7 +97,7 @@ func HandleSearchEvent(event tcell.Event, v *View) {
 		return
 	}
 
-	Search(messenger.response, v, true)
+	Search(messenger.response, v, searchDown)
 
 	v.Relocate()
 
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dgv/zed/runewidth"
+)
+
+// An Option is a setting that can be changed in settings.json, with a
+// command line flag of the same name, or while editing with set and setlocal
+type Option struct {
+	Name string
+	// The value the option has if it is not set. Values of the option have
+	// the same type: bool, int or string
+	Default interface{}
+	Usage   string
+	// Local options can have their own value for a file type or a buffer
+	Local bool
+	// Validate returns an error if a value can't be used
+	Validate func(interface{}) error
+	// Changed is called when the global value of the option changes
+	Changed func()
+}
+
+var options = []*Option{
+	{Name: "tabsize", Default: 4, Usage: "tab size to be used", Local: true, Validate: between(1, 64)},
+	{Name: "tabstospaces", Default: false, Usage: "indent with spaces instead of tabs", Local: true},
+	{Name: "indentchar", Default: " ", Usage: "character tabs are drawn with", Local: true, Validate: singleCell},
+	{Name: "scrollmargin", Default: 0, Usage: "lines kept in view above and below the cursor", Validate: nonNegative},
+	{Name: "autopairs", Default: "auto", Usage: "pairs of characters closed automatically, such as ()[]{}, or auto for the ones of the file type", Local: true, Validate: validPairs},
+	{Name: "autocomplete", Default: 0, Usage: "offer word completions after typing this many word characters, 0 to only offer them on request", Local: true, Validate: nonNegative},
+	{Name: "textwidth", Default: 80, Usage: "width ReflowParagraph and autowrap wrap lines to", Local: true, Validate: between(1, 1000)},
+	{Name: "autowrap", Default: false, Usage: "wrap lines automatically when typing past textwidth", Local: true},
+	{Name: "softwrap", Default: false, Usage: "wrap long lines onto the following rows instead of scrolling sideways", Local: true},
+	{Name: "foldmethod", Default: "auto", Usage: "how foldable blocks are found: auto, indent, brackets or markers", Local: true, Validate: oneOf("auto", "indent", "brackets", "markers")},
+	{Name: "clipboard", Default: "auto", Usage: "clipboard provider: auto, wl-copy, xclip, xsel, pbcopy, tmux, osc52, system or internal", Validate: validClipboard},
+	{Name: "keymap", Default: "default", Usage: "key bindings to use: default, vi for modal editing or emacs", Validate: oneOf("default", "vi", "emacs")},
+	{Name: "fileformat", Default: "unix", Usage: "line endings of files: unix, dos or mac", Local: true, Validate: oneOf("unix", "dos", "mac")},
+	{Name: "encoding", Default: "utf-8", Usage: "encoding of files: utf-8, utf-8-bom, latin1, utf-16be or utf-16le", Local: true, Validate: oneOf("utf-8", "utf-8-bom", "latin1", "utf-16be", "utf-16le")},
+	{Name: "rmtrailingws", Default: false, Usage: "remove trailing whitespace when saving", Local: true},
+	{Name: "eofnewline", Default: false, Usage: "end files with a newline when saving", Local: true},
+	{Name: "editorconfig", Default: true, Usage: "apply the settings of .editorconfig files to the files they cover"},
+	{Name: "modeline", Default: true, Usage: "apply the settings in the vim and emacs modelines of files"},
+	{Name: "commandtimeout", Default: 30, Usage: "seconds FilterThroughCommand waits for a command before killing it, 0 to wait forever", Validate: nonNegative},
+	{Name: "keytimeout", Default: 1000, Usage: "milliseconds to wait for the next key of a key sequence, 0 to wait forever", Validate: nonNegative},
+}
+
+var (
+	optionsByName = make(map[string]*Option)
+
+	// The global value of every option
+	globalSettings = make(map[string]interface{})
+
+	// Values for buffers of a file type, from the "ft:<type>" objects in
+	// settings.json
+	fileTypeSettings = make(map[string]map[string]interface{})
+
+	// Values given with command line flags, which win over settings.json
+	flagSettings = make(map[string]interface{})
+)
+
+func init() {
+	for _, o := range options {
+		optionsByName[o.Name] = o
+		globalSettings[o.Name] = o.Default
+		flag.Var(&optionFlag{o}, o.Name, o.Usage)
+	}
+	// These are set here as they lead back to the actions, which refer to
+	// the options
+	optionsByName["clipboard"].Changed = InitClipboard
+	optionsByName["keymap"].Changed = keymapChanged
+}
+
+func between(min, max int) func(interface{}) error {
+	return func(v interface{}) error {
+		if n := v.(int); n < min || n > max {
+			return fmt.Errorf("must be from %d to %d", min, max)
+		}
+		return nil
+	}
+}
+
+func nonNegative(v interface{}) error {
+	if v.(int) < 0 {
+		return fmt.Errorf("can't be negative")
+	}
+	return nil
+}
+
+func singleCell(v interface{}) error {
+	if r := []rune(v.(string)); len(r) != 1 || runewidth.RuneWidth(r[0]) != 1 {
+		return fmt.Errorf("must be a single character one cell wide")
+	}
+	return nil
+}
+
+func oneOf(values ...string) func(interface{}) error {
+	return func(v interface{}) error {
+		for _, value := range values {
+			if v.(string) == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(values, ", "))
+	}
+}
+
+func validPairs(v interface{}) error {
+	if pairs := v.(string); pairs != "auto" && Count(pairs)%2 != 0 {
+		return fmt.Errorf("must be pairs of characters or auto")
+	}
+	return nil
+}
+
+func validClipboard(v interface{}) error {
+	if name := v.(string); name != "auto" {
+		if _, ok := findClipboard(name); !ok {
+			return fmt.Errorf("unknown clipboard provider %q", name)
+		}
+	}
+	return nil
+}
+
+// validInt reports whether an int option accepts n. Sizes read from files
+// are checked with it, so absurd ones are ignored
+func validInt(name string, n int) bool {
+	return optionsByName[name].Validate(n) == nil
+}
+
+// keymapChanged rebinds the keys for the new keymap
+func keymapChanged() {
+	for _, v := range views {
+		v.viReset()
+	}
+	if errs := loadBindings(); len(errs) > 0 {
+		messenger.Alert(strings.Join(errs, "; "))
+	}
+}
+
+// parse converts a value read from settings.json or typed by the user to the
+// type of the option, and validates it
+func (o *Option) parse(value interface{}) (interface{}, error) {
+	var parsed interface{}
+	switch o.Default.(type) {
+	case bool:
+		switch v := value.(type) {
+		case bool:
+			parsed = v
+		case string:
+			switch strings.ToLower(v) {
+			case "true", "on", "yes":
+				parsed = true
+			case "false", "off", "no":
+				parsed = false
+			}
+		}
+		if parsed == nil {
+			return nil, fmt.Errorf("%s must be true or false", o.Name)
+		}
+	case int:
+		switch v := value.(type) {
+		case float64:
+			if v == float64(int(v)) {
+				parsed = int(v)
+			}
+		case string:
+			if n, err := strconv.Atoi(v); err == nil {
+				parsed = n
+			}
+		}
+		if parsed == nil {
+			return nil, fmt.Errorf("%s must be a whole number", o.Name)
+		}
+	case string:
+		v, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be a string", o.Name)
+		}
+		parsed = v
+	}
+	if o.Validate != nil {
+		if err := o.Validate(parsed); err != nil {
+			return nil, fmt.Errorf("%s %v", o.Name, err)
+		}
+	}
+	return parsed, nil
+}
+
+// findOption returns the option called name
+func findOption(name string) (*Option, error) {
+	o, ok := optionsByName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown option %q", name)
+	}
+	return o, nil
+}
+
+// optionFlag is the command line flag of an option
+type optionFlag struct {
+	opt *Option
+}
+
+func (f *optionFlag) String() string {
+	if f.opt == nil {
+		return ""
+	}
+	return fmt.Sprint(f.opt.Default)
+}
+
+func (f *optionFlag) Set(s string) error {
+	v, err := f.opt.parse(s)
+	if err != nil {
+		return err
+	}
+	flagSettings[f.opt.Name] = v
+	globalSettings[f.opt.Name] = v
+	return nil
+}
+
+// IsBoolFlag lets bool options be given as -name, without a value
+func (f *optionFlag) IsBoolFlag() bool {
+	_, ok := f.opt.Default.(bool)
+	return ok
+}
+
+// GetOption returns the global value of an option
+func GetOption(name string) interface{} {
+	return globalSettings[name]
+}
+
+// IntOption returns the global value of an int option
+func IntOption(name string) int {
+	return GetOption(name).(int)
+}
+
+// BoolOption returns the global value of a bool option
+func BoolOption(name string) bool {
+	return GetOption(name).(bool)
+}
+
+// StringOption returns the global value of a string option
+func StringOption(name string) string {
+	return GetOption(name).(string)
+}
+
+// Option returns the value of an option for the buffer: its own value if it
+// has one, else the value for its file type, else the global value
+func (b *Buffer) Option(name string) interface{} {
+	if v, ok := b.Settings[name]; ok {
+		return v
+	}
+	if v, ok := fileTypeSettings[b.FileType][name]; ok {
+		return v
+	}
+	return globalSettings[name]
+}
+
+// IntOption returns the buffer's value of an int option
+func (b *Buffer) IntOption(name string) int {
+	return b.Option(name).(int)
+}
+
+// BoolOption returns the buffer's value of a bool option
+func (b *Buffer) BoolOption(name string) bool {
+	return b.Option(name).(bool)
+}
+
+// StringOption returns the buffer's value of a string option
+func (b *Buffer) StringOption(name string) string {
+	return b.Option(name).(string)
+}
+
+// settingsFile returns the path settings are read from and saved to
+func settingsFile() string {
+	return filepath.Join(ConfigDir(), "settings.json")
+}
+
+// readSettingsFile returns the contents of settings.json
+func readSettingsFile() (map[string]interface{}, error) {
+	saved := make(map[string]interface{})
+	data, err := ioutil.ReadFile(settingsFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return saved, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("%s: %v", settingsFile(), err)
+	}
+	return saved, nil
+}
+
+// InitSettings loads settings.json and applies the command line flags over it
+func InitSettings() {
+	if errs := loadSettings(); len(errs) > 0 {
+		TermMessage(strings.Join(errs, "\n"))
+	}
+}
+
+// loadSettings sets the options to their values in settings.json, or their
+// defaults, and the values of the flags over them. It returns a message for
+// every value that is invalid
+func loadSettings() []string {
+	for _, o := range options {
+		globalSettings[o.Name] = o.Default
+	}
+	fileTypeSettings = make(map[string]map[string]interface{})
+
+	var errs []string
+	saved, err := readSettingsFile()
+	if err != nil {
+		errs = append(errs, err.Error())
+	}
+	names := make([]string, 0, len(saved))
+	for name := range saved {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !strings.HasPrefix(name, "ft:") {
+			if err := setSetting(globalSettings, name, saved[name], false); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", settingsFile(), err))
+			}
+			continue
+		}
+		values, ok := saved[name].(map[string]interface{})
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s: %s must be an object of options", settingsFile(), name))
+			continue
+		}
+		ft := strings.TrimPrefix(name, "ft:")
+		fileTypeSettings[ft] = make(map[string]interface{})
+		for opt, value := range values {
+			if err := setSetting(fileTypeSettings[ft], opt, value, true); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s: %v", settingsFile(), name, err))
+			}
+		}
+	}
+
+	// Flags win over the file type values in settings.json too
+	for name, v := range flagSettings {
+		globalSettings[name] = v
+		for _, values := range fileTypeSettings {
+			delete(values, name)
+		}
+	}
+	return errs
+}
+
+// setSetting parses value and sets option name to it in settings. local
+// tells whether the settings are for a file type or a buffer
+func setSetting(settings map[string]interface{}, name string, value interface{}, local bool) error {
+	o, err := findOption(name)
+	if err != nil {
+		return err
+	}
+	if local && !o.Local {
+		return fmt.Errorf("%s is a global option", name)
+	}
+	v, err := o.parse(value)
+	if err != nil {
+		return err
+	}
+	settings[name] = v
+	return nil
+}
+
+// saveSetting saves the value of an option to settings.json, in the object
+// of file type ft if it is not empty
+func saveSetting(ft, name string, value interface{}) error {
+	saved, err := readSettingsFile()
+	if err != nil {
+		return err
+	}
+	if ft == "" {
+		saved[name] = value
+	} else {
+		values, ok := saved["ft:"+ft].(map[string]interface{})
+		if !ok {
+			values = make(map[string]interface{})
+			saved["ft:"+ft] = values
+		}
+		values[name] = value
+	}
+
+	data, err := json.MarshalIndent(saved, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(ConfigDir(), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(settingsFile(), append(data, '\n'), 0644)
+}
+
+// SetOption sets the global value of an option, and saves it to
+// settings.json if save is set
+func SetOption(name string, value interface{}, save bool) error {
+	if err := setSetting(globalSettings, name, value, false); err != nil {
+		return err
+	}
+	if o := optionsByName[name]; o.Changed != nil {
+		o.Changed()
+	}
+	if save {
+		return saveSetting("", name, globalSettings[name])
+	}
+	return nil
+}
+
+// SetLocalOption sets the buffer's own value of an option. If save is set
+// the value is saved to settings.json for the buffer's file type
+func (b *Buffer) SetLocalOption(name string, value interface{}, save bool) error {
+	if b.Settings == nil {
+		b.Settings = make(map[string]interface{})
+	}
+	if err := setSetting(b.Settings, name, value, true); err != nil {
+		return err
+	}
+	if save {
+		if b.FileType == "" {
+			return fmt.Errorf("the buffer has no file type to save %s for", name)
+		}
+		return saveSetting(b.FileType, name, b.Settings[name])
+	}
+	return nil
+}
+
+// setCommand runs "set [-save] name [value]", or setlocal if local is set.
+// A bool option given without a value is toggled
+func (v *View) setCommand(args []string, local bool) {
+	save := len(args) > 0 && args[0] == "-save"
+	if save {
+		args = args[1:]
+	}
+	if len(args) == 0 || len(args) > 2 {
+		messenger.Alert("usage: set [-save] option value")
+		return
+	}
+	// set toggles the global value and setlocal the buffer's
+	cur := GetOption(args[0])
+	if local {
+		cur = v.Buf.Option(args[0])
+	}
+	var value interface{}
+	if len(args) == 2 {
+		value = args[1]
+	} else if cur, ok := cur.(bool); ok {
+		value = !cur
+	} else {
+		messenger.Alert("no value given for ", args[0])
+		return
+	}
+
+	var err error
+	if local {
+		err = v.Buf.SetLocalOption(args[0], value, save)
+	} else {
+		err = SetOption(args[0], value, save)
+	}
+	if err != nil {
+		messenger.Alert(err)
+	}
+}
+
+// showCommand runs "show [option]", which shows the value of an option in
+// the current buffer, or lists all of them
+func (v *View) showCommand(args []string) {
+	if len(args) > 1 {
+		messenger.Alert("usage: show [option]")
+		return
+	}
+	if len(args) == 1 {
+		if _, err := findOption(args[0]); err != nil {
+			messenger.Alert(err)
+			return
+		}
+		messenger.Alert(args[0], " = ", v.Buf.Option(args[0]))
+		return
+	}
+
+	names := make([]string, 0, len(options))
+	for _, o := range options {
+		names = append(names, o.Name)
+	}
+	sort.Strings(names)
+	list := make([]string, len(names))
+	for i, name := range names {
+		list[i] = fmt.Sprintf("%s = %v", name, v.Buf.Option(name))
+	}
+	messenger.Choose("options ", list)
+}
+
+// Set asks for an option and a value and sets the option for every buffer
+func (v *View) Set() bool {
+	input, canceled := messenger.Prompt("set: ", "", "Set")
+	if !canceled {
+		v.setCommand(SplitCommandArgs(input), false)
+	}
+
+	return true
+}
+
+// SetLocal asks for an option and a value and sets the option for the
+// current buffer
+func (v *View) SetLocal() bool {
+	input, canceled := messenger.Prompt("setlocal: ", "", "Set")
+	if !canceled {
+		v.setCommand(SplitCommandArgs(input), true)
+	}
+
+	return true
+}
+
+// Show asks for an option and shows its value
+func (v *View) Show() bool {
+	input, canceled := messenger.Prompt("show: ", "", "Set")
+	if !canceled {
+		v.showCommand(SplitCommandArgs(input))
+	}
+
+	return false
+}
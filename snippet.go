@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// snippets maps a file type to the snippets for it, by trigger word. The
+// snippets under "default" are available in every file type
+var snippets map[string]map[string]string
+
+// snippetsFile returns the path snippets are loaded from
+func snippetsFile() string {
+	return filepath.Join(ConfigDir(), "snippets.json")
+}
+
+// InitSnippets loads the user's snippets
+func InitSnippets() {
+	snippets = make(map[string]map[string]string)
+
+	data, err := ioutil.ReadFile(snippetsFile())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			TermMessage("Error reading snippets:", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &snippets); err != nil {
+		TermMessage("Error reading snippets:", err)
+	}
+}
+
+// findSnippet returns the body of the snippet with the given trigger
+func findSnippet(fileType, trigger string) (string, bool) {
+	if body, ok := snippets[fileType][trigger]; ok {
+		return body, true
+	}
+	body, ok := snippets["default"][trigger]
+	return body, ok
+}
+
+// snippetField is a placeholder in a parsed snippet, given as rune offsets
+// into its text
+type snippetField struct {
+	num        int
+	start, end int
+}
+
+// parseSnippet expands a snippet body into the text to insert and its
+// fields. Fields are written $1 or ${1:default}, $0 is where the cursor
+// ends up and a field that appears more than once is mirrored. Every line
+// after the first is indented by indent, and tabs that start a line in the
+// body are replaced by indentUnit
+func parseSnippet(body, indent, indentUnit string) ([]rune, []snippetField) {
+	type token struct {
+		text   string
+		num    int
+		field  bool
+		hasDef bool
+	}
+
+	// Split the body into literal text and fields
+	var tokens []token
+	var lit []rune
+	src := []rune(body)
+	lineStart := true
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case lineStart && c == '\t':
+			lit = append(lit, []rune(indentUnit)...)
+			continue
+		case c == '\n':
+			lit = append(lit, '\n')
+			lit = append(lit, []rune(indent)...)
+			lineStart = true
+			continue
+		case c == '\\' && i+1 < len(src) && strings.ContainsRune(`$\}`, src[i+1]):
+			i++
+			lit = append(lit, src[i])
+		case c == '$' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			j := i + 1
+			num := 0
+			for ; j < len(src) && src[j] >= '0' && src[j] <= '9'; j++ {
+				num = num*10 + int(src[j]-'0')
+			}
+			tokens = append(tokens, token{text: string(lit)}, token{num: num, field: true})
+			lit = nil
+			i = j - 1
+		case c == '$' && i+2 < len(src) && src[i+1] == '{' && src[i+2] >= '0' && src[i+2] <= '9':
+			j := i + 2
+			num := 0
+			for ; j < len(src) && src[j] >= '0' && src[j] <= '9'; j++ {
+				num = num*10 + int(src[j]-'0')
+			}
+			var def []rune
+			hasDef := j < len(src) && src[j] == ':'
+			if hasDef {
+				for j++; j < len(src) && src[j] != '}'; j++ {
+					if src[j] == '\\' && j+1 < len(src) {
+						j++
+					}
+					def = append(def, src[j])
+				}
+			}
+			if j >= len(src) || src[j] != '}' {
+				// Not a field after all
+				lit = append(lit, c)
+				break
+			}
+			tokens = append(tokens, token{text: string(lit)}, token{text: string(def), num: num, field: true, hasDef: hasDef})
+			lit = nil
+			i = j
+		default:
+			lit = append(lit, c)
+		}
+		lineStart = false
+	}
+	tokens = append(tokens, token{text: string(lit)})
+
+	// Mirrors show the default of whichever occurrence of the field has one
+	defaults := make(map[int]string)
+	for _, t := range tokens {
+		if _, ok := defaults[t.num]; t.field && t.hasDef && !ok {
+			defaults[t.num] = t.text
+		}
+	}
+
+	var text []rune
+	var fields []snippetField
+	for _, t := range tokens {
+		if !t.field {
+			text = append(text, []rune(t.text)...)
+			continue
+		}
+		start := len(text)
+		if t.num != 0 {
+			text = append(text, []rune(defaults[t.num])...)
+		}
+		fields = append(fields, snippetField{t.num, start, len(text)})
+	}
+	return text, fields
+}
+
+// snippetRange is the text covered by one occurrence of a field
+type snippetRange struct {
+	start, end *Anchor
+}
+
+// text returns the text in the range
+func (r snippetRange) text(buf *Buffer) string {
+	return buf.Substr(r.start.Loc, r.end.Loc)
+}
+
+// SnippetSession is an expanded snippet whose fields are being filled in.
+// Each stop holds the occurrences of one field, the first of which is
+// edited and the rest mirror it
+type SnippetSession struct {
+	buf     *Buffer
+	stops   [][]snippetRange
+	current int
+}
+
+// newSnippetSession anchors the fields of a snippet inserted at start
+func newSnippetSession(buf *Buffer, start Loc, text []rune, fields []snippetField) *SnippetSession {
+	s := &SnippetSession{buf: buf}
+
+	// Stops are visited in increasing order, $0 or the end of the snippet last
+	var nums []int
+	byNum := make(map[int][]snippetField)
+	for _, f := range fields {
+		if _, ok := byNum[f.num]; !ok && f.num != 0 {
+			nums = append(nums, f.num)
+		}
+		byNum[f.num] = append(byNum[f.num], f)
+	}
+	sort.Ints(nums)
+	if final, ok := byNum[0]; ok {
+		byNum[0] = final[:1]
+	} else {
+		byNum[0] = []snippetField{{0, len(text), len(text)}}
+	}
+	nums = append(nums, 0)
+
+	for _, num := range nums {
+		var stop []snippetRange
+		for _, f := range byNum[num] {
+			r := snippetRange{
+				start: &Anchor{Loc: start.Move(f.start, buf), Left: true},
+				end:   &Anchor{Loc: start.Move(f.end, buf)},
+			}
+			buf.AddAnchor(r.start)
+			buf.AddAnchor(r.end)
+			stop = append(stop, r)
+		}
+		s.stops = append(s.stops, stop)
+	}
+	return s
+}
+
+// close stops the buffer from tracking the session's fields
+func (s *SnippetSession) close() {
+	for _, stop := range s.stops {
+		for _, r := range stop {
+			s.buf.RemoveAnchor(r.start)
+			s.buf.RemoveAnchor(r.end)
+		}
+	}
+}
+
+// endSnippet ends the snippet session, if there is one
+func (v *View) endSnippet() {
+	if v.snippet != nil {
+		v.snippet.close()
+		v.snippet = nil
+	}
+}
+
+// selectSnippetStop moves to stop i of the snippet session, selecting its
+// placeholder text. Reaching the last stop ends the session
+func (v *View) selectSnippetStop(i int) {
+	s := v.snippet
+	s.current = i
+	r := s.stops[i][0]
+	v.Cursor.ResetSelection()
+	if r.start.Loc != r.end.Loc {
+		v.Cursor.SetSelectionStart(r.start.Loc)
+		v.Cursor.SetSelectionEnd(r.end.Loc)
+		v.Cursor.OrigSelection = v.Cursor.CurSelection
+	}
+	v.Cursor.Loc = r.end.Loc
+	v.Cursor.LastVisualX = v.Cursor.GetVisualX()
+
+	if i == len(s.stops)-1 {
+		v.endSnippet()
+	}
+}
+
+// ExpandSnippet replaces the snippet trigger before the cursor with the
+// snippet and selects its first field
+func (v *View) ExpandSnippet() bool {
+	if v.Cursor.HasSelection() {
+		return false
+	}
+	start, trigger := v.wordBeforeCursor()
+	if trigger == "" {
+		return false
+	}
+	body, ok := findSnippet(v.Buf.FileType, trigger)
+	if !ok {
+		return false
+	}
+	v.endSnippet()
+
+	indent := GetLeadingWhitespace(v.Buf.Line(start.Y))
+	text, fields := parseSnippet(body, indent, v.Buf.IndentString())
+	v.Buf.BeginGroup()
+	v.Buf.Replace(start, v.Cursor.Loc, string(text))
+	v.Buf.EndGroup()
+
+	v.snippet = newSnippetSession(v.Buf, start, text, fields)
+	v.selectSnippetStop(0)
+
+	return true
+}
+
+// NextSnippetStop moves to the next field of the snippet being filled in
+func (v *View) NextSnippetStop() bool {
+	if v.snippet == nil {
+		return false
+	}
+	v.selectSnippetStop(v.snippet.current + 1)
+
+	return true
+}
+
+// PreviousSnippetStop moves to the previous field of the snippet being
+// filled in
+func (v *View) PreviousSnippetStop() bool {
+	if v.snippet == nil || v.snippet.current == 0 {
+		return false
+	}
+	v.selectSnippetStop(v.snippet.current - 1)
+
+	return true
+}
+
+// updateSnippet copies the text of the field being edited to its mirrors,
+// and ends the session once the cursor leaves the field
+func (v *View) updateSnippet() {
+	s := v.snippet
+	if s == nil {
+		return
+	}
+	stop := s.stops[s.current]
+	field := stop[0]
+	if v.Cursor.Loc.LessThan(field.start.Loc) || v.Cursor.Loc.GreaterThan(field.end.Loc) {
+		v.endSnippet()
+		return
+	}
+
+	text := field.text(v.Buf)
+	cursor := &Anchor{Loc: v.Cursor.Loc}
+	v.Buf.AddAnchor(cursor)
+	for _, mirror := range stop[1:] {
+		if mirror.text(v.Buf) != text {
+			v.Buf.Replace(mirror.start.Loc, mirror.end.Loc, text)
+		}
+	}
+	v.Buf.RemoveAnchor(cursor)
+	v.Cursor.Loc = cursor.Loc
+}
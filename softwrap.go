@@ -0,0 +1,170 @@
+package main
+
+import (
+	"unicode"
+
+	"github.com/dgv/zed/runewidth"
+)
+
+// softWrapMarker is drawn in the gutter next to rows that continue a line
+const softWrapMarker = '↪'
+
+// lineWidths returns the visual width of every prefix of line: element i is
+// the width of the first i runes. Widths are measured like StringWidth does
+func lineWidths(line string, tabsize int) []int {
+	widths := []int{0}
+	width, lineIdx := 0, 0
+	for _, c := range line {
+		if c == '\t' {
+			ts := tabsize - (lineIdx % tabsize)
+			width += ts
+			lineIdx += ts
+		} else {
+			width += runewidth.RuneWidth(c)
+			lineIdx++
+		}
+		widths = append(widths, width)
+	}
+	return widths
+}
+
+// wrapRows splits line into rows no wider than width and returns the index
+// of the rune each row starts at. Rows are broken after whitespace where
+// possible. A line that exactly fills its last row gets an empty row after it
+// so the cursor has somewhere to go at its end
+func wrapRows(line string, width, tabsize int) []int {
+	runes := []rune(line)
+	widths := lineWidths(line, tabsize)
+	rows := []int{0}
+	start, brk := 0, -1
+	for i := range runes {
+		if widths[i+1]-widths[start] > width && i > start {
+			next := i
+			if brk > start {
+				next = brk
+			}
+			rows = append(rows, next)
+			start, brk = next, -1
+			for j := start; j < i; j++ {
+				if unicode.IsSpace(runes[j]) {
+					brk = j + 1
+				}
+			}
+		}
+		if unicode.IsSpace(runes[i]) {
+			brk = i + 1
+		}
+	}
+	if len(runes) > start && widths[len(runes)]-widths[start] >= width {
+		rows = append(rows, len(runes))
+	}
+	return rows
+}
+
+// rowOf returns which of the rows of a line the rune at x is on
+func rowOf(rows []int, x int) int {
+	r := 0
+	for r+1 < len(rows) && rows[r+1] <= x {
+		r++
+	}
+	return r
+}
+
+// gutterWidth returns how many columns the gutter left of the text takes
+func (v *View) gutterWidth() int {
+	if v.Buf.BoolOption("softwrap") || len(v.folds) > 0 || len(v.Buf.bookmarks) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// lineRows returns where the rows of line y start when soft wrapping. Without
+// soft wrap every line is a single row, and folded lines have none
+func (v *View) lineRows(y int) []int {
+	if v.hiddenBy(y) != nil {
+		return nil
+	}
+	if !v.Buf.BoolOption("softwrap") {
+		return []int{0}
+	}
+	return wrapRows(v.Buf.Line(y), v.Width-v.lineNumOffset, v.Buf.IntOption("tabsize"))
+}
+
+// rowsBefore returns how many rows are between the top of the view and the
+// row loc is on
+func (v *View) rowsBefore(loc Loc) int {
+	rows := 0
+	for y := v.Topline; y < loc.Y; y++ {
+		rows += len(v.lineRows(y))
+	}
+	return rows + rowOf(v.lineRows(loc.Y), loc.X)
+}
+
+// screenPos returns where on the screen loc is drawn
+func (v *View) screenPos(loc Loc) (int, int) {
+	line := v.Buf.Line(loc.Y)
+	widths := lineWidths(line, v.Buf.IntOption("tabsize"))
+	if !v.Buf.BoolOption("softwrap") {
+		return v.x + v.lineNumOffset + widths[loc.X] - v.leftCol, v.y + loc.Y - v.Topline
+	}
+	rows := v.lineRows(loc.Y)
+	start := rows[rowOf(rows, loc.X)]
+	return v.x + v.lineNumOffset + widths[loc.X] - widths[start], v.y + v.rowsBefore(loc)
+}
+
+// cursorUpN moves the cursor up n rows, or down if n is negative. When soft
+// wrapping that moves between the rows of a line too, and folded lines are
+// skipped
+func (v *View) cursorUpN(n int) {
+	if !v.Buf.BoolOption("softwrap") && len(v.folds) == 0 {
+		v.Cursor.UpN(n)
+		return
+	}
+
+	y := v.Cursor.Y
+	rows := v.lineRows(y)
+	r := rowOf(rows, v.Cursor.X)
+	widths := lineWidths(v.Buf.Line(y), v.Buf.IntOption("tabsize"))
+	col := Max(0, v.Cursor.LastVisualX-widths[rows[r]])
+
+	for ; n > 0; n-- {
+		if r > 0 {
+			r--
+		} else if prev := v.nextVisibleLine(y, -1); prev != y {
+			y = prev
+			rows = v.lineRows(y)
+			r = len(rows) - 1
+		}
+	}
+	for ; n < 0; n++ {
+		if r < len(rows)-1 {
+			r++
+		} else if next := v.nextVisibleLine(y, 1); next != y {
+			y = next
+			rows = v.lineRows(y)
+			r = 0
+		}
+	}
+
+	// Find the rune in the row closest to the column the cursor was in.
+	// Only the last row may end with the cursor past its last rune
+	widths = lineWidths(v.Buf.Line(y), v.Buf.IntOption("tabsize"))
+	start, end := rows[r], len(widths)-1
+	if r < len(rows)-1 {
+		end = rows[r+1] - 1
+	}
+	x := start
+	for x < end && widths[x+1]-widths[start] <= col {
+		x++
+	}
+	v.Cursor.Loc = Loc{x, y}
+	v.Cursor.LastVisualX = widths[start] + col
+}
+
+// ToggleSoftWrap turns soft wrapping of long lines on or off
+func (v *View) ToggleSoftWrap() bool {
+	v.Buf.SetLocalOption("softwrap", !v.Buf.BoolOption("softwrap"), false)
+	v.leftCol = 0
+
+	return true
+}
@@ -196,6 +196,8 @@ func (s *cScreen) SetTitle(title string) {
 	procSetConsoleTitle.Call(uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(title))))
 }
 
+func (s *cScreen) SetClipboard(data []byte) {}
+
 func (s *cScreen) Fini() {
 	s.Lock()
 	s.style = StyleDefault
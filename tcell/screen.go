@@ -195,6 +195,11 @@ type Screen interface {
 	HasKey(Key) bool
 
 	SetTitle(string)
+
+	// SetClipboard asks the terminal to put the data on the system clipboard
+	// using the OSC 52 escape sequence. Terminals that don't support it
+	// ignore the request.
+	SetClipboard([]byte)
 }
 
 // NewScreen returns a default Screen suitable for the user's terminal
@@ -16,6 +16,7 @@ package tcell
 
 import (
 	"bytes"
+	"encoding/base64"
 	"io"
 	"os"
 	"runtime"
@@ -1509,3 +1510,14 @@ func (t *tScreen) SetTitle(title string) {
 		t.hasSetTitle = true
 	}
 }
+
+func (t *tScreen) SetClipboard(data []byte) {
+	seq := "\033]52;c;" + base64.StdEncoding.EncodeToString(data) + "\007"
+	// Wrap the sequence so that tmux or screen pass it on to the terminal
+	if os.Getenv("TMUX") != "" {
+		seq = "\033Ptmux;\033" + seq + "\033\\"
+	} else if strings.HasPrefix(os.Getenv("TERM"), "screen") {
+		seq = "\033P" + seq + "\033\\"
+	}
+	t.TPuts(seq)
+}
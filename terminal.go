@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dgv/zed/tcell"
+)
+
+// A Terminal is a pane below the view with the user's shell running in it.
+// What the shell prints arrives in the background and is handed to the
+// emulator by the main loop
+type Terminal struct {
+	vt    *VT
+	pty   *os.File
+	cmd   *exec.Cmd
+	shell string
+
+	// The rows the screen is drawn in. The title bar is the row above y
+	y, Width, Height int
+	// How many lines the pane is scrolled back from the bottom
+	scroll int
+
+	// Guards what follows, which the goroutine reading the pty writes
+	lock    sync.Mutex
+	pending []byte
+	done    bool
+}
+
+var (
+	// The terminal pane, if one is open
+	terminal *Terminal
+	// Whether keys go to the terminal pane instead of the view
+	terminalFocused bool
+)
+
+// ToggleTerminal opens a terminal pane running the user's shell below the
+// view, or moves the focus between the pane and the view
+func (v *View) ToggleTerminal() bool {
+	if terminal != nil {
+		terminalFocused = !terminalFocused
+		return false
+	}
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "sh"
+	}
+	cmd := exec.Command(shell)
+	if v.Buf.Path != "" {
+		cmd.Dir = filepath.Dir(v.Buf.AbsPath)
+	}
+	// The pane shows text attributes but no colors, so programs are told
+	// the terminal has none. Otherwise they'd use color alone to set text
+	// apart, which would be lost
+	cmd.Env = append(os.Environ(), "TERM=xterm-mono", "COLORTERM=", "NO_COLOR=1")
+	w, h := screen.Size()
+	rows := terminalRows(h)
+	pty, err := startPty(cmd, w, rows)
+	if err != nil {
+		messenger.Alert(err)
+		return false
+	}
+
+	t := &Terminal{pty: pty, cmd: cmd, shell: filepath.Base(shell)}
+	t.vt = NewVT(w, rows, func(reply []byte) {
+		t.pty.Write(reply)
+	})
+	go func() {
+		// Reading fails once the shell has exited
+		data := make([]byte, 4096)
+		for {
+			n, err := pty.Read(data)
+			t.lock.Lock()
+			t.pending = append(t.pending, data[:n]...)
+			t.done = err != nil
+			t.lock.Unlock()
+			wakeMainLoop()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	terminal, terminalFocused = t, true
+	layout(w, h)
+
+	return false
+}
+
+// TerminalToBuffer opens the scrollback and the screen of the terminal pane
+// in a new buffer
+func (v *View) TerminalToBuffer() bool {
+	if terminal == nil {
+		messenger.Alert("no terminal is open")
+		return false
+	}
+	if !v.CanClose() {
+		return false
+	}
+	buf := NewBufferFromString(terminal.vt.Text(), "")
+	buf.name = "terminal: " + terminal.shell
+	buf.Cursor.Loc = buf.End()
+	v.OpenBuffer(buf)
+	terminalFocused = false
+
+	return true
+}
+
+// terminalRows returns how many rows of a screen h rows high the terminal
+// pane's screen takes
+func terminalRows(h int) int {
+	return Max((h-1)/2-1, 1)
+}
+
+// layout places the view and the terminal pane, if one is open, on a screen
+// of the given size. The pane takes the bottom half, above the status line
+func layout(w, h int) {
+	if terminal == nil {
+		views[mainView].Resize(w, h)
+		return
+	}
+	rows := terminalRows(h)
+	views[mainView].Resize(w, h-rows-1)
+	terminal.resize(w, h-rows-1, rows)
+}
+
+func (t *Terminal) resize(w, y, h int) {
+	t.y, t.Width, t.Height = y, w, h
+	t.vt.Resize(w, h)
+	t.scroll = Min(t.scroll, len(t.vt.scrollback))
+	setPtySize(t.pty, w, h)
+}
+
+// updateTerminal hands what the shell printed to the terminal pane's
+// emulator, and closes the pane once the shell has exited
+func updateTerminal() {
+	t := terminal
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	data, done := t.pending, t.done
+	t.pending = nil
+	t.lock.Unlock()
+
+	if t.scroll > 0 {
+		// Stay on the same lines while new ones arrive
+		lines := len(t.vt.scrollback)
+		t.vt.Write(data)
+		t.scroll = Min(t.scroll+len(t.vt.scrollback)-lines, len(t.vt.scrollback))
+	} else {
+		t.vt.Write(data)
+	}
+
+	if done {
+		t.pty.Close()
+		go t.cmd.Wait()
+		terminal, terminalFocused = nil, false
+		if screen != nil {
+			layout(screen.Size())
+		}
+	}
+}
+
+// Display draws the terminal pane's title bar and the part of its screen
+// and scrollback it is scrolled to
+func (t *Terminal) Display() {
+	title := " " + t.shell + " "
+	if t.scroll > 0 {
+		title += fmt.Sprintf("[%d/%d] ", len(t.vt.scrollback)-t.scroll+1, len(t.vt.scrollback))
+	}
+	titleStyle := defStyle.Reverse(true).Bold(terminalFocused)
+	titleRunes := []rune(title)
+	for x := 0; x < t.Width; x++ {
+		r := ' '
+		if x < len(titleRunes) {
+			r = titleRunes[x]
+		}
+		screen.SetContent(x, t.y-1, r, nil, titleStyle)
+	}
+
+	first := t.vt.NumLines() - t.vt.Height - t.scroll
+	for y := 0; y < t.Height && y < t.vt.Height; y++ {
+		for x, c := range t.vt.Line(first + y) {
+			if x >= t.Width {
+				break
+			}
+			if c.r != 0 {
+				screen.SetContent(x, t.y+y, c.r, nil, c.style)
+			}
+		}
+	}
+
+	if terminalFocused {
+		if t.vt.cursorVisible && t.scroll == 0 {
+			screen.ShowCursor(t.vt.cx, t.y+t.vt.cy)
+		} else {
+			screen.HideCursor()
+		}
+	}
+}
+
+// HandleEvent sends keys and pastes to the shell. Keys bound to actions on
+// the terminal pane run them instead, and shift-pageup and shift-pagedown
+// scroll through the scrollback
+func (t *Terminal) HandleEvent(event tcell.Event) {
+	switch e := event.(type) {
+	case *tcell.EventKey:
+		actions := bindings.lookup(keyOf(e))
+		for _, action := range actions {
+			switch ShortFuncName(action) {
+			case "ToggleTerminal", "TerminalToBuffer":
+				views[mainView].ExecuteActions(actions)
+				return
+			}
+		}
+		if e.Modifiers() == tcell.ModShift {
+			switch e.Key() {
+			case tcell.KeyPgUp:
+				t.scroll = Min(t.scroll+t.Height-1, len(t.vt.scrollback))
+				return
+			case tcell.KeyPgDn:
+				t.scroll = Max(t.scroll-t.Height+1, 0)
+				return
+			}
+		}
+		t.scroll = 0
+		t.pty.Write([]byte(t.keyText(e)))
+	case *tcell.EventPaste:
+		text := strings.Replace(e.Text(), "\n", "\r", -1)
+		if t.vt.bracketedPaste {
+			text = "\x1b[200~" + text + "\x1b[201~"
+		}
+		t.scroll = 0
+		t.pty.Write([]byte(text))
+	}
+}
+
+// The final characters of the sequences xterm sends for keys, and the
+// numbers of those that end with a tilde
+var (
+	vtLetterKeys = map[tcell.Key]string{
+		tcell.KeyUp: "A", tcell.KeyDown: "B", tcell.KeyRight: "C", tcell.KeyLeft: "D",
+		tcell.KeyHome: "H", tcell.KeyEnd: "F",
+		tcell.KeyF1: "P", tcell.KeyF2: "Q", tcell.KeyF3: "R", tcell.KeyF4: "S",
+	}
+	vtTildeKeys = map[tcell.Key]string{
+		tcell.KeyInsert: "2", tcell.KeyDelete: "3", tcell.KeyPgUp: "5", tcell.KeyPgDn: "6",
+		tcell.KeyF5: "15", tcell.KeyF6: "17", tcell.KeyF7: "18", tcell.KeyF8: "19",
+		tcell.KeyF9: "20", tcell.KeyF10: "21", tcell.KeyF11: "23", tcell.KeyF12: "24",
+	}
+)
+
+// vtModifiedKeys holds the keys tcell has names for that include their
+// modifiers
+var vtModifiedKeys = map[tcell.Key]struct {
+	key tcell.Key
+	mod tcell.ModMask
+}{
+	tcell.KeyAltUp:          {tcell.KeyUp, tcell.ModAlt},
+	tcell.KeyAltDown:        {tcell.KeyDown, tcell.ModAlt},
+	tcell.KeyAltLeft:        {tcell.KeyLeft, tcell.ModAlt},
+	tcell.KeyAltRight:       {tcell.KeyRight, tcell.ModAlt},
+	tcell.KeyCtrlUp:         {tcell.KeyUp, tcell.ModCtrl},
+	tcell.KeyCtrlDown:       {tcell.KeyDown, tcell.ModCtrl},
+	tcell.KeyCtrlLeft:       {tcell.KeyLeft, tcell.ModCtrl},
+	tcell.KeyCtrlRight:      {tcell.KeyRight, tcell.ModCtrl},
+	tcell.KeyShiftUp:        {tcell.KeyUp, tcell.ModShift},
+	tcell.KeyShiftDown:      {tcell.KeyDown, tcell.ModShift},
+	tcell.KeyShiftLeft:      {tcell.KeyLeft, tcell.ModShift},
+	tcell.KeyShiftRight:     {tcell.KeyRight, tcell.ModShift},
+	tcell.KeyAltShiftUp:     {tcell.KeyUp, tcell.ModAlt | tcell.ModShift},
+	tcell.KeyAltShiftDown:   {tcell.KeyDown, tcell.ModAlt | tcell.ModShift},
+	tcell.KeyAltShiftLeft:   {tcell.KeyLeft, tcell.ModAlt | tcell.ModShift},
+	tcell.KeyAltShiftRight:  {tcell.KeyRight, tcell.ModAlt | tcell.ModShift},
+	tcell.KeyCtrlShiftUp:    {tcell.KeyUp, tcell.ModCtrl | tcell.ModShift},
+	tcell.KeyCtrlShiftDown:  {tcell.KeyDown, tcell.ModCtrl | tcell.ModShift},
+	tcell.KeyCtrlShiftLeft:  {tcell.KeyLeft, tcell.ModCtrl | tcell.ModShift},
+	tcell.KeyCtrlShiftRight: {tcell.KeyRight, tcell.ModCtrl | tcell.ModShift},
+	tcell.KeyCtrlPgUp:       {tcell.KeyPgUp, tcell.ModCtrl},
+	tcell.KeyCtrlPgDn:       {tcell.KeyPgDn, tcell.ModCtrl},
+}
+
+// keyText returns what xterm sends to a program for a key
+func (t *Terminal) keyText(e *tcell.EventKey) string {
+	key, mod := e.Key(), e.Modifiers()
+	if m, ok := vtModifiedKeys[key]; ok {
+		key, mod = m.key, mod|m.mod
+	}
+
+	switch {
+	case key == tcell.KeyRune || key < tcell.KeyRune:
+		text := string(e.Rune())
+		if key != tcell.KeyRune {
+			text = string(rune(key))
+		}
+		if mod&tcell.ModAlt != 0 {
+			text = "\x1b" + text
+		}
+		return text
+	case key == tcell.KeyBacktab:
+		return "\x1b[Z"
+	}
+
+	// xterm adds a parameter with the modifiers to the sequence
+	param := 1
+	if mod&tcell.ModShift != 0 {
+		param++
+	}
+	if mod&tcell.ModAlt != 0 {
+		param += 2
+	}
+	if mod&tcell.ModCtrl != 0 {
+		param += 4
+	}
+	if final, ok := vtLetterKeys[key]; ok {
+		switch {
+		case param > 1:
+			return "\x1b[1;" + strconv.Itoa(param) + final
+		case key >= tcell.KeyF1 || t.vt.appCursor:
+			return "\x1bO" + final
+		}
+		return "\x1b[" + final
+	}
+	if n, ok := vtTildeKeys[key]; ok {
+		if param > 1 {
+			return "\x1b[" + n + ";" + strconv.Itoa(param) + "~"
+		}
+		return "\x1b[" + n + "~"
+	}
+	return ""
+}
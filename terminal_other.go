@@ -0,0 +1,17 @@
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func startPty(cmd *exec.Cmd, w, h int) (*os.File, error) {
+	return nil, errors.New("the terminal is only supported on Linux")
+}
+
+func setPtySize(master *os.File, w, h int) error {
+	return nil
+}
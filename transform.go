@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// textTransforms maps the names accepted by the Transform prompt to the
+// functions that transform the text
+var textTransforms = map[string]func(string) (string, error){
+	"upper":        func(s string) (string, error) { return strings.ToUpper(s), nil },
+	"lower":        func(s string) (string, error) { return strings.ToLower(s), nil },
+	"title":        func(s string) (string, error) { return titleCase(s), nil },
+	"snake":        func(s string) (string, error) { return convertIdentifiers(s, joinSnake), nil },
+	"camel":        func(s string) (string, error) { return convertIdentifiers(s, joinCamel), nil },
+	"kebab":        func(s string) (string, error) { return convertIdentifiers(s, joinKebab), nil },
+	"sort":         func(s string) (string, error) { return mapLines(s, sortLines), nil },
+	"sortnumeric":  func(s string) (string, error) { return mapLines(s, sortLinesNumeric), nil },
+	"sortreverse":  func(s string) (string, error) { return mapLines(s, sortLinesReverse), nil },
+	"sortunique":   func(s string) (string, error) { return mapLines(s, sortLinesUnique), nil },
+	"reverse":      func(s string) (string, error) { return mapLines(s, reverseLines), nil },
+	"shuffle":      func(s string) (string, error) { return mapLines(s, shuffleLines), nil },
+	"base64encode": func(s string) (string, error) { return base64.StdEncoding.EncodeToString([]byte(s)), nil },
+	"base64decode": base64Decode,
+	"urlencode":    func(s string) (string, error) { return url.QueryEscape(s), nil },
+	"urldecode":    url.QueryUnescape,
+	"jsonminify":   jsonMinify,
+	"jsonvalidate": jsonValidate,
+}
+
+// bufferTransforms are the transforms that depend on the settings of the
+// buffer, such as how it is indented
+var bufferTransforms = map[string]func(*Buffer, string) (string, error){
+	"jsonpretty": jsonPretty,
+}
+
+// transformTarget returns the bounds of the text a transform applies to:
+// the selection if there is one, the whole buffer otherwise
+func (v *View) transformTarget() (Loc, Loc) {
+	if v.Cursor.HasSelection() {
+		start, end := v.Cursor.CurSelection[0], v.Cursor.CurSelection[1]
+		if start.GreaterThan(end) {
+			start, end = end, start
+		}
+		return start, end
+	}
+	return v.Buf.Start(), v.Buf.End()
+}
+
+// transform runs the named transform on the selection or the whole buffer
+// and replaces the text with the result
+func (v *View) transform(name string) bool {
+	fn, ok := textTransforms[name]
+	if bufferFn, isBuffer := bufferTransforms[name]; isBuffer {
+		fn, ok = func(s string) (string, error) { return bufferFn(v.Buf, s) }, true
+	}
+	if !ok {
+		messenger.Alert("unknown transform: ", name)
+		return false
+	}
+
+	start, end := v.transformTarget()
+	text := v.Buf.Substr(start, end)
+	result, err := fn(text)
+	if err != nil {
+		messenger.Alert(name, ": ", err)
+		return false
+	}
+	if result == text {
+		return true
+	}
+
+	hadSelection := v.Cursor.HasSelection()
+	v.Buf.Replace(start, end, result)
+	if hadSelection {
+		v.Cursor.SetSelectionStart(start)
+		v.Cursor.SetSelectionEnd(start.Move(Count(result), v.Buf))
+		v.Cursor.OrigSelection = v.Cursor.CurSelection
+		v.Cursor.Loc = v.Cursor.CurSelection[1]
+	} else {
+		v.Cursor.ResetSelection()
+		v.Cursor.Relocate()
+	}
+
+	return true
+}
+
+// Transform prompts for the name of a transform and runs it
+func (v *View) Transform() bool {
+	name, canceled := messenger.Prompt("transform: ", "", "Transform")
+	if canceled {
+		return false
+	}
+	return v.transform(strings.ToLower(strings.TrimSpace(name)))
+}
+
+// UpperCase converts the text to upper case
+func (v *View) UpperCase() bool { return v.transform("upper") }
+
+// LowerCase converts the text to lower case
+func (v *View) LowerCase() bool { return v.transform("lower") }
+
+// TitleCase capitalizes every word of the text
+func (v *View) TitleCase() bool { return v.transform("title") }
+
+// SnakeCase converts the identifiers in the text to snake_case
+func (v *View) SnakeCase() bool { return v.transform("snake") }
+
+// CamelCase converts the identifiers in the text to camelCase
+func (v *View) CamelCase() bool { return v.transform("camel") }
+
+// KebabCase converts the identifiers in the text to kebab-case
+func (v *View) KebabCase() bool { return v.transform("kebab") }
+
+// SortLines sorts the lines alphabetically
+func (v *View) SortLines() bool { return v.transform("sort") }
+
+// SortLinesNumeric sorts the lines by the number they start with
+func (v *View) SortLinesNumeric() bool { return v.transform("sortnumeric") }
+
+// SortLinesReverse sorts the lines alphabetically in reverse order
+func (v *View) SortLinesReverse() bool { return v.transform("sortreverse") }
+
+// SortLinesUnique sorts the lines alphabetically and drops duplicates
+func (v *View) SortLinesUnique() bool { return v.transform("sortunique") }
+
+// ReverseLines reverses the order of the lines
+func (v *View) ReverseLines() bool { return v.transform("reverse") }
+
+// ShuffleLines puts the lines in random order
+func (v *View) ShuffleLines() bool { return v.transform("shuffle") }
+
+// Base64Encode encodes the text as base64
+func (v *View) Base64Encode() bool { return v.transform("base64encode") }
+
+// Base64Decode decodes the text from base64
+func (v *View) Base64Decode() bool { return v.transform("base64decode") }
+
+// URLEncode escapes the text for use in a URL query
+func (v *View) URLEncode() bool { return v.transform("urlencode") }
+
+// URLDecode unescapes URL query text
+func (v *View) URLDecode() bool { return v.transform("urldecode") }
+
+// JSONPrettyPrint indents the JSON text
+func (v *View) JSONPrettyPrint() bool { return v.transform("jsonpretty") }
+
+// JSONMinify removes the insignificant whitespace from the JSON text
+func (v *View) JSONMinify() bool { return v.transform("jsonminify") }
+
+// JSONValidate reports whether the text is valid JSON
+func (v *View) JSONValidate() bool { return v.transform("jsonvalidate") }
+
+// titleCase upper cases the first letter of every word and lower cases the rest
+func titleCase(s string) string {
+	runes := []rune(s)
+	inWord := false
+	for i, r := range runes {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'' {
+			if inWord {
+				runes[i] = unicode.ToLower(r)
+			} else {
+				runes[i] = unicode.ToUpper(r)
+			}
+			inWord = true
+		} else {
+			inWord = false
+		}
+	}
+	return string(runes)
+}
+
+// splitIdentifier splits an identifier such as fooBar, foo_bar, foo-bar or
+// HTTPServer into its lower case words
+func splitIdentifier(id string) []string {
+	var words []string
+	var cur []rune
+	runes := []rune(id)
+	flush := func() {
+		if len(cur) > 0 {
+			words = append(words, strings.ToLower(string(cur)))
+			cur = nil
+		}
+	}
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-':
+			flush()
+			continue
+		case unicode.IsUpper(r) && len(cur) > 0:
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			// A new word starts at fooBar and at the R of HTTPRequest
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+		cur = append(cur, r)
+	}
+	flush()
+	return words
+}
+
+func joinSnake(words []string) string { return strings.Join(words, "_") }
+
+func joinKebab(words []string) string { return strings.Join(words, "-") }
+
+func joinCamel(words []string) string {
+	for i := 1; i < len(words); i++ {
+		r := []rune(words[i])
+		r[0] = unicode.ToUpper(r[0])
+		words[i] = string(r)
+	}
+	return strings.Join(words, "")
+}
+
+// convertIdentifiers rewrites every identifier in s with join, leaving
+// everything between identifiers untouched
+func convertIdentifiers(s string, join func([]string) string) string {
+	runes := []rune(s)
+	isAlnum := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+	// A hyphen only joins the words of kebab-case, so it has to sit between
+	// letters or digits. Those of "a - b", "a->b" and "-x" are left alone
+	isIdent := func(i int) bool {
+		if runes[i] == '-' {
+			return i > 0 && i+1 < len(runes) && isAlnum(runes[i-1]) && isAlnum(runes[i+1])
+		}
+		return isAlnum(runes[i]) || runes[i] == '_'
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(runes); {
+		if !isIdent(i) {
+			buf.WriteRune(runes[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && isIdent(j) {
+			j++
+		}
+		if words := splitIdentifier(string(runes[i:j])); len(words) > 0 {
+			buf.WriteString(join(words))
+		} else {
+			buf.WriteString(string(runes[i:j]))
+		}
+		i = j
+	}
+	return buf.String()
+}
+
+// mapLines runs fn on the lines of s. A trailing newline is kept out of the
+// lines so that selecting whole lines works as expected
+func mapLines(s string, fn func([]string) []string) string {
+	trailing := strings.HasSuffix(s, "\n")
+	if trailing {
+		s = s[:len(s)-1]
+	}
+	s = strings.Join(fn(strings.Split(s, "\n")), "\n")
+	if trailing {
+		s += "\n"
+	}
+	return s
+}
+
+func sortLines(lines []string) []string {
+	sort.Strings(lines)
+	return lines
+}
+
+func sortLinesReverse(lines []string) []string {
+	sort.Sort(sort.Reverse(sort.StringSlice(lines)))
+	return lines
+}
+
+func sortLinesUnique(lines []string) []string {
+	sort.Strings(lines)
+	unique := lines[:0]
+	for i, l := range lines {
+		if i == 0 || l != lines[i-1] {
+			unique = append(unique, l)
+		}
+	}
+	return unique
+}
+
+// leadingNumber parses the number at the start of a line
+func leadingNumber(line string) (float64, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(fields[0], 64)
+	return n, err == nil
+}
+
+// sortLinesNumeric sorts lines by their leading number. Lines that don't start
+// with a number come last, in alphabetical order
+func sortLinesNumeric(lines []string) []string {
+	sort.SliceStable(lines, func(i, j int) bool {
+		a, aok := leadingNumber(lines[i])
+		b, bok := leadingNumber(lines[j])
+		switch {
+		case aok && bok:
+			return a < b
+		case aok != bok:
+			return aok
+		}
+		return lines[i] < lines[j]
+	})
+	return lines
+}
+
+func reverseLines(lines []string) []string {
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
+
+func shuffleLines(lines []string) []string {
+	rand.Shuffle(len(lines), func(i, j int) {
+		lines[i], lines[j] = lines[j], lines[i]
+	})
+	return lines
+}
+
+func base64Decode(s string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+	return string(data), err
+}
+
+func jsonPretty(b *Buffer, s string) (string, error) {
+	var buf bytes.Buffer
+	err := json.Indent(&buf, []byte(s), "", b.IndentString())
+	return buf.String(), err
+}
+
+func jsonMinify(s string) (string, error) {
+	var buf bytes.Buffer
+	err := json.Compact(&buf, []byte(s))
+	return buf.String(), err
+}
+
+func jsonValidate(s string) (string, error) {
+	var x interface{}
+	if err := json.Unmarshal([]byte(s), &x); err != nil {
+		return "", err
+	}
+	messenger.Alert("valid JSON")
+	return s, nil
+}
@@ -172,6 +172,16 @@ func EscapePath(path string) string {
 	return strings.Replace(path, "/", "%", -1)
 }
 
+// ConfigDir returns the directory zed keeps its configuration in:
+// $XDG_CONFIG_HOME/zed, or ~/.config/zed if XDG_CONFIG_HOME is not set
+func ConfigDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "zed")
+	}
+	home, _ := homedir.Dir()
+	return filepath.Join(home, ".config", "zed")
+}
+
 // GetModTime returns the last modification time for a given file
 // It also returns a boolean if there was a problem accessing the file
 func GetModTime(path string) (time.Time, bool) {
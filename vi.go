@@ -0,0 +1,1226 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/dgv/zed/tcell"
+)
+
+// ViMode is a mode of the vi keymap
+type ViMode int
+
+// The modes of the vi keymap
+const (
+	ViNormal ViMode = iota
+	ViInsert
+	ViVisual
+	ViVisualLine
+)
+
+var viModeNames = map[ViMode]string{
+	ViNormal:     "NORMAL",
+	ViInsert:     "INSERT",
+	ViVisual:     "VISUAL",
+	ViVisualLine: "VISUAL LINE",
+}
+
+// Commands that are shorthands for an operator and a motion
+var viAliases = map[rune]string{
+	'x': "dl",
+	'X': "dh",
+	'D': "d$",
+	'C': "c$",
+	's': "cl",
+	'S': "cc",
+	'Y': "yy",
+}
+
+// ViState is the state of a view's vi keymap
+type ViState struct {
+	mode ViMode
+
+	// The keys of the command being typed, and the events they came from
+	pending []rune
+	events  []tcell.Event
+
+	// The events of the change being made and of the last finished change,
+	// which . repeats
+	change     []tcell.Event
+	changing   bool
+	lastChange []tcell.Event
+
+	// Where the selection started in visual mode
+	visualStart Loc
+
+	// The unnamed register, and whether it holds whole lines
+	register string
+	linewise bool
+
+	// The last f, F, t or T motion, which ; and , repeat
+	lastFind string
+}
+
+// status returns the mode and the keys typed so far, to be shown in the
+// status line
+func (s *ViState) status() string {
+	status := "-- " + viModeNames[s.mode] + " --"
+	if len(s.pending) > 0 {
+		status += " " + string(s.pending)
+	}
+	return status
+}
+
+// viEnabled returns whether the vi keymap is in use
+func viEnabled() bool {
+	return StringOption("keymap") == "vi"
+}
+
+// viCommand is a parsed vi command such as "a3dw": a register, a count, an
+// operator and the motion, text object or command it applies to
+type viCommand struct {
+	register rune
+	count    int
+	op       rune
+	key      string
+}
+
+// The results of parsing the keys typed so far
+const (
+	viIncomplete = iota
+	viInvalid
+	viDone
+)
+
+// parseViCommand parses the keys typed in normal or visual mode
+func parseViCommand(keys []rune, visual bool) (viCommand, int) {
+	var cmd viCommand
+	i := 0
+	if keys[i] == '"' {
+		if len(keys) < 3 {
+			return cmd, viIncomplete
+		}
+		cmd.register = keys[i+1]
+		i += 2
+	}
+	readCount := func() int {
+		n := 0
+		for i < len(keys) && unicode.IsDigit(keys[i]) && (n > 0 || keys[i] != '0') {
+			n = n*10 + int(keys[i]-'0')
+			i++
+		}
+		return n
+	}
+	cmd.count = readCount()
+	if i == len(keys) {
+		return cmd, viIncomplete
+	}
+
+	if alias, ok := viAliases[keys[i]]; ok && !visual && i == len(keys)-1 {
+		cmd.op, cmd.key = rune(alias[0]), alias[1:]
+		if cmd.key == "c" || cmd.key == "y" {
+			cmd.key = "_"
+		}
+		return cmd, viDone
+	}
+	if strings.ContainsRune("dcy<>", keys[i]) && !visual {
+		cmd.op = keys[i]
+		i++
+		if n := readCount(); n > 0 {
+			cmd.count = Max(cmd.count, 1) * n
+		}
+		if i == len(keys) {
+			return cmd, viIncomplete
+		}
+		if keys[i] == cmd.op {
+			// Doubling the operator applies it to whole lines
+			cmd.key = "_"
+			return cmd, viDone
+		}
+	}
+
+	r := keys[i]
+	need := 1
+	switch {
+	case strings.ContainsRune("fFtTrm`'gzZ", r):
+		need = 2
+	case (r == 'i' || r == 'a') && (cmd.op != 0 || visual):
+		need = 2
+	}
+	if len(keys)-i < need {
+		return cmd, viIncomplete
+	}
+	if len(keys)-i > need {
+		return cmd, viInvalid
+	}
+	cmd.key = string(keys[i:])
+	return cmd, viDone
+}
+
+// viKey returns the key an event stands for in normal and visual mode. Keys
+// vi has no use for are left to the bindings
+func viKey(e *tcell.EventKey) (rune, bool) {
+	switch e.Key() {
+	case tcell.KeyRune:
+		if e.Modifiers()&(tcell.ModAlt|tcell.ModCtrl) != 0 {
+			return 0, false
+		}
+		return e.Rune(), true
+	case tcell.KeyUp:
+		return 'k', true
+	case tcell.KeyDown:
+		return 'j', true
+	case tcell.KeyLeft, tcell.KeyBackspace, tcell.KeyBackspace2:
+		return 'h', true
+	case tcell.KeyRight:
+		return 'l', true
+	case tcell.KeyHome:
+		return '0', true
+	case tcell.KeyEnd:
+		return '$', true
+	case tcell.KeyDelete:
+		return 'x', true
+	case tcell.KeyEnter, tcell.KeyEscape, tcell.KeyTab, tcell.KeyCtrlR,
+		tcell.KeyCtrlO, tcell.KeyCtrlD, tcell.KeyCtrlU:
+		return rune(e.Key()), true
+	}
+	return 0, false
+}
+
+// viHandleKey handles a key event when the vi keymap is in use. It returns
+// false if the event should be handled by the bindings instead
+func (v *View) viHandleKey(e *tcell.EventKey) bool {
+	s := &v.vi
+	if s.mode == ViInsert {
+		if s.changing {
+			s.change = append(s.change, e)
+		}
+		if e.Key() == tcell.KeyEscape {
+			v.viEndInsert()
+			return true
+		}
+		return false
+	}
+
+	r, ok := viKey(e)
+	if !ok {
+		return false
+	}
+	if s.mode == ViNormal && v.Cursor.HasSelection() {
+		// A search leaves its match selected
+		v.Cursor.Loc = v.Cursor.CurSelection[0]
+		v.Cursor.ResetSelection()
+	}
+	if r == rune(tcell.KeyEscape) {
+		switch {
+		case len(s.pending) > 0:
+		case s.mode != ViNormal:
+			v.viExitVisual()
+		default:
+			v.Escape()
+		}
+		s.pending, s.events = nil, nil
+		return true
+	}
+
+	s.pending = append(s.pending, r)
+	s.events = append(s.events, e)
+	cmd, status := parseViCommand(s.pending, s.mode != ViNormal)
+	if status == viIncomplete {
+		return true
+	}
+	events := s.events
+	s.pending, s.events = nil, nil
+	if status == viDone {
+		v.viExecute(cmd, events)
+	}
+
+	switch s.mode {
+	case ViNormal:
+		v.viClampCursor()
+	case ViVisual, ViVisualLine:
+		v.viClampCursor()
+		v.viUpdateVisual()
+	}
+	return true
+}
+
+// viReset ends the change being made and goes back to normal mode
+func (v *View) viReset() {
+	if v.vi.changing {
+		v.vi.changing = false
+		v.Buf.EndGroup()
+	}
+	v.vi.mode = ViNormal
+	v.vi.pending, v.vi.events = nil, nil
+}
+
+// viRecordPaste adds a paste to the change being made
+func (v *View) viRecordPaste(e *tcell.EventPaste) {
+	if v.vi.changing {
+		v.vi.change = append(v.vi.change, e)
+	}
+}
+
+// viClampCursor keeps the cursor on a character, as it can't be past the end
+// of a line outside of insert mode
+func (v *View) viClampCursor() {
+	if n := Count(v.Buf.Line(v.Cursor.Y)); v.Cursor.X >= n {
+		v.Cursor.X = Max(0, n-1)
+	}
+}
+
+// viBeginChange starts a change that is undone as one and repeated by .
+func (v *View) viBeginChange(events []tcell.Event) {
+	v.vi.change = append([]tcell.Event(nil), events...)
+	v.vi.changing = true
+	v.Buf.BeginGroup()
+}
+
+// viEndChange finishes the change, unless it went on into insert mode
+func (v *View) viEndChange() {
+	if v.vi.mode == ViInsert || !v.vi.changing {
+		return
+	}
+	v.vi.lastChange = v.vi.change
+	v.vi.changing = false
+	v.Buf.EndGroup()
+}
+
+// viInsert enters insert mode
+func (v *View) viInsert() {
+	v.vi.mode = ViInsert
+	v.Cursor.ResetSelection()
+}
+
+// viEndInsert goes back to normal mode from insert mode
+func (v *View) viEndInsert() {
+	v.vi.mode = ViNormal
+	v.viEndChange()
+	if v.Cursor.X > 0 {
+		v.Cursor.X--
+	}
+	v.Cursor.LastVisualX = v.Cursor.GetVisualX()
+}
+
+// viExitVisual goes back to normal mode from visual mode
+func (v *View) viExitVisual() {
+	v.vi.mode = ViNormal
+	v.Cursor.ResetSelection()
+	v.viClampCursor()
+}
+
+// viUpdateVisual selects the text between where visual mode started and the
+// cursor
+func (v *View) viUpdateVisual() {
+	start, end := v.vi.visualStart, v.Cursor.Loc
+	if end.LessThan(start) {
+		start, end = end, start
+	}
+	if v.vi.mode == ViVisualLine {
+		start.X = 0
+		end = v.Buf.viLineEnd(end.Y)
+	} else {
+		end, _ = v.Buf.viNext(end)
+	}
+	v.Cursor.SetSelectionStart(start)
+	v.Cursor.SetSelectionEnd(end)
+}
+
+// viLineEnd returns where line y ends including its newline
+func (b *Buffer) viLineEnd(y int) Loc {
+	if y+1 < b.NumLines {
+		return Loc{0, y + 1}
+	}
+	return Loc{Count(b.Line(y)), y}
+}
+
+// viAt returns the character at loc, or a newline at the end of a line
+func (b *Buffer) viAt(loc Loc) rune {
+	line := []rune(b.Line(loc.Y))
+	if loc.X >= len(line) {
+		return '\n'
+	}
+	return line[loc.X]
+}
+
+// viNext returns the location after loc, where the newline at the end of a
+// line counts as a character
+func (b *Buffer) viNext(loc Loc) (Loc, bool) {
+	if loc.X < Count(b.Line(loc.Y)) {
+		return Loc{loc.X + 1, loc.Y}, true
+	}
+	if loc.Y+1 < b.NumLines {
+		return Loc{0, loc.Y + 1}, true
+	}
+	return loc, false
+}
+
+// viPrev returns the location before loc
+func (b *Buffer) viPrev(loc Loc) (Loc, bool) {
+	if loc.X > 0 {
+		return Loc{loc.X - 1, loc.Y}, true
+	}
+	if loc.Y > 0 {
+		return Loc{Count(b.Line(loc.Y - 1)), loc.Y - 1}, true
+	}
+	return loc, false
+}
+
+// viClass returns the class of a character for word motions: 0 for
+// whitespace, 1 for word characters and 2 for punctuation. Big words are any
+// run of non-whitespace
+func viClass(r rune, big bool) int {
+	switch {
+	case IsWhitespace(r) || r == '\n':
+		return 0
+	case big || IsWordChar(string(r)):
+		return 1
+	}
+	return 2
+}
+
+// viEmptyLine returns whether loc is on an empty line
+func (b *Buffer) viEmptyLine(loc Loc) bool {
+	return loc.X == 0 && Count(b.Line(loc.Y)) == 0
+}
+
+// viWordForward returns the start of the word after loc
+func (b *Buffer) viWordForward(loc Loc, big bool) Loc {
+	ok := true
+	if c := viClass(b.viAt(loc), big); c != 0 {
+		for ok && viClass(b.viAt(loc), big) == c {
+			loc, ok = b.viNext(loc)
+		}
+	}
+	for ok && viClass(b.viAt(loc), big) == 0 {
+		loc, ok = b.viNext(loc)
+		if ok && b.viEmptyLine(loc) {
+			break
+		}
+	}
+	return loc
+}
+
+// viWordEnd returns the end of the word after loc
+func (b *Buffer) viWordEnd(loc Loc, big bool) Loc {
+	loc, ok := b.viNext(loc)
+	for ok && viClass(b.viAt(loc), big) == 0 {
+		loc, ok = b.viNext(loc)
+	}
+	c := viClass(b.viAt(loc), big)
+	for {
+		next, ok := b.viNext(loc)
+		if !ok || viClass(b.viAt(next), big) != c {
+			return loc
+		}
+		loc = next
+	}
+}
+
+// viWordBackward returns the start of the word before loc
+func (b *Buffer) viWordBackward(loc Loc, big bool) Loc {
+	loc, ok := b.viPrev(loc)
+	for ok && viClass(b.viAt(loc), big) == 0 {
+		if b.viEmptyLine(loc) {
+			return loc
+		}
+		loc, ok = b.viPrev(loc)
+	}
+	c := viClass(b.viAt(loc), big)
+	for {
+		prev, ok := b.viPrev(loc)
+		if !ok || viClass(b.viAt(prev), big) != c {
+			return loc
+		}
+		loc = prev
+	}
+}
+
+// viFirstNonBlank returns the index of the first non-whitespace character of
+// line y
+func (b *Buffer) viFirstNonBlank(y int) int {
+	return Count(GetLeadingWhitespace(b.Line(y)))
+}
+
+// viFind finds the count-th occurrence of a character on the cursor's line
+// for the f, F, t and T motions
+func (v *View) viFind(key string, count int) (Loc, bool) {
+	line := []rune(v.Buf.Line(v.Cursor.Y))
+	kind, target := rune(key[0]), []rune(key)[1]
+	dir := 1
+	if kind == 'F' || kind == 'T' {
+		dir = -1
+	}
+	x := v.Cursor.X
+	for ; count > 0; count-- {
+		x += dir
+		for x >= 0 && x < len(line) && line[x] != target {
+			x += dir
+		}
+		if x < 0 || x >= len(line) {
+			return Loc{}, false
+		}
+	}
+	switch kind {
+	case 't':
+		x--
+	case 'T':
+		x++
+	}
+	return Loc{x, v.Cursor.Y}, true
+}
+
+// viMotion returns where a motion moves the cursor to, whether it covers
+// whole lines and whether an operator applied to it includes the character
+// it ends on
+func (v *View) viMotion(cmd viCommand) (target Loc, linewise, inclusive, ok bool) {
+	b := v.Buf
+	c := v.Cursor.Loc
+	count := Max(cmd.count, 1)
+	last := b.NumLines - 1
+	lineStart := func(y int) Loc {
+		y = Max(0, Min(y, last))
+		return Loc{b.viFirstNonBlank(y), y}
+	}
+
+	switch cmd.key {
+	case "h":
+		return Loc{Max(0, c.X-count), c.Y}, false, false, true
+	case "l", " ":
+		return Loc{Min(c.X+count, Count(b.Line(c.Y))), c.Y}, false, false, true
+	case "j", "k":
+		y := c.Y + count
+		if cmd.key == "k" {
+			y = c.Y - count
+		}
+		y = Max(0, Min(y, last))
+		return Loc{v.Cursor.GetCharPosInLine(y, v.Cursor.LastVisualX), y}, true, false, true
+	case "+", "\r":
+		return lineStart(c.Y + count), true, false, true
+	case "-":
+		return lineStart(c.Y - count), true, false, true
+	case "_":
+		return lineStart(c.Y + count - 1), true, false, true
+	case "0":
+		return Loc{0, c.Y}, false, false, true
+	case "^":
+		return lineStart(c.Y), false, false, true
+	case "$":
+		y := Min(c.Y+count-1, last)
+		return Loc{Count(b.Line(y)), y}, false, false, true
+	case "w", "W":
+		big := cmd.key == "W"
+		target = c
+		for i := 0; i < count; i++ {
+			target = b.viWordForward(target, big)
+		}
+		if cmd.op == 'c' && viClass(b.viAt(c), big) != 0 {
+			// cw changes to the end of the word, like ce
+			target = c
+			for i := 0; i < count; i++ {
+				if i == 0 && viClass(b.viAt(Loc{c.X + 1, c.Y}), big) != viClass(b.viAt(c), big) {
+					// The cursor is on the last character of the word
+					continue
+				}
+				target = b.viWordEnd(target, big)
+			}
+			return target, false, true, true
+		}
+		if cmd.op != 0 && target.Y > c.Y && count == 1 {
+			// An operator on the last word of a line stops at its end
+			target = Loc{Count(b.Line(c.Y)), c.Y}
+		}
+		return target, false, false, true
+	case "b", "B":
+		target = c
+		for i := 0; i < count; i++ {
+			target = b.viWordBackward(target, cmd.key == "B")
+		}
+		return target, false, false, true
+	case "e", "E":
+		target = c
+		for i := 0; i < count; i++ {
+			target = b.viWordEnd(target, cmd.key == "E")
+		}
+		return target, false, true, true
+	case "gg":
+		return lineStart(Max(cmd.count, 1) - 1), true, false, true
+	case "G":
+		if cmd.count == 0 {
+			return lineStart(last), true, false, true
+		}
+		return lineStart(cmd.count - 1), true, false, true
+	case "{", "}":
+		dir := 1
+		if cmd.key == "{" {
+			dir = -1
+		}
+		y := c.Y
+		for i := 0; i < count; i++ {
+			// Skip blank lines, then the paragraph up to the next blank line
+			for y+dir >= 0 && y+dir <= last && IsStrWhitespace(b.Line(y+dir)) {
+				y += dir
+			}
+			for y+dir >= 0 && y+dir <= last && !IsStrWhitespace(b.Line(y+dir)) {
+				y += dir
+			}
+			y += dir
+		}
+		if y < 0 {
+			return Loc{0, 0}, false, false, true
+		} else if y > last {
+			return Loc{Count(b.Line(last)), last}, false, false, true
+		}
+		return Loc{0, y}, false, false, true
+	case "%":
+		line := []rune(b.Line(c.Y))
+		for x := c.X; x < len(line); x++ {
+			for _, bp := range bracePairs {
+				if line[x] == bp[0] || line[x] == bp[1] {
+					match, found := v.FindMatchingBrace(Loc{x, c.Y})
+					return match, false, true, found
+				}
+			}
+		}
+		return c, false, false, false
+	case ";", ",":
+		if v.vi.lastFind == "" {
+			return c, false, false, false
+		}
+		key := v.vi.lastFind
+		if cmd.key == "," {
+			reverse := map[byte]string{'f': "F", 'F': "f", 't': "T", 'T': "t"}
+			key = reverse[key[0]] + key[1:]
+		}
+		target, ok = v.viFind(key, count)
+		return target, false, key[0] == 'f' || key[0] == 't', ok
+	}
+
+	if k := []rune(cmd.key); len(k) > 1 {
+		switch k[0] {
+		case 'f', 'F', 't', 'T':
+			v.vi.lastFind = cmd.key
+			target, ok = v.viFind(cmd.key, count)
+			return target, false, k[0] == 'f' || k[0] == 't', ok
+		case '`', '\'':
+			a, found := b.marks[k[1]]
+			if !found {
+				return c, false, false, false
+			}
+			if k[0] == '\'' {
+				return lineStart(a.Y), true, false, true
+			}
+			return b.clampLoc(a.Loc), false, false, true
+		}
+	}
+	return c, false, false, false
+}
+
+// viRange is the text an operator applies to. Linewise ranges cover the
+// lines from start.Y to end.Y, otherwise end is exclusive
+type viRange struct {
+	start, end Loc
+	linewise   bool
+}
+
+// viTextObject returns the text a text object such as iw or a( covers
+func (v *View) viTextObject(key string) (viRange, bool) {
+	b := v.Buf
+	c := v.Cursor.Loc
+	inner := key[0] == 'i'
+	obj := []rune(key)[1]
+	line := []rune(b.Line(c.Y))
+
+	switch obj {
+	case 'w', 'W':
+		if len(line) == 0 {
+			return viRange{}, false
+		}
+		x := Min(c.X, len(line)-1)
+		cls := viClass(line[x], obj == 'W')
+		start, end := x, x+1
+		for start > 0 && viClass(line[start-1], obj == 'W') == cls {
+			start--
+		}
+		for end < len(line) && viClass(line[end], obj == 'W') == cls {
+			end++
+		}
+		if !inner {
+			if cls == 0 {
+				// Whitespace and the word after it
+				if end < len(line) {
+					next := viClass(line[end], obj == 'W')
+					for end < len(line) && viClass(line[end], obj == 'W') == next {
+						end++
+					}
+				}
+			} else if end < len(line) && viClass(line[end], false) == 0 {
+				for end < len(line) && viClass(line[end], false) == 0 {
+					end++
+				}
+			} else {
+				for start > 0 && viClass(line[start-1], false) == 0 {
+					start--
+				}
+			}
+		}
+		return viRange{start: Loc{start, c.Y}, end: Loc{end, c.Y}}, true
+	case '"', '\'', '`':
+		var quotes []int
+		for x, r := range line {
+			if r == obj && (x == 0 || line[x-1] != '\\') {
+				quotes = append(quotes, x)
+			}
+		}
+		for i := 0; i+1 < len(quotes); i += 2 {
+			open, close := quotes[i], quotes[i+1]
+			if c.X <= close {
+				if inner {
+					return viRange{start: Loc{open + 1, c.Y}, end: Loc{close, c.Y}}, true
+				}
+				return viRange{start: Loc{open, c.Y}, end: Loc{close + 1, c.Y}}, true
+			}
+		}
+		return viRange{}, false
+	case 'p':
+		blank := IsStrWhitespace(b.Line(c.Y))
+		start, end := c.Y, c.Y
+		for start > 0 && IsStrWhitespace(b.Line(start-1)) == blank {
+			start--
+		}
+		for end+1 < b.NumLines && IsStrWhitespace(b.Line(end+1)) == blank {
+			end++
+		}
+		if !inner && !blank {
+			for end+1 < b.NumLines && IsStrWhitespace(b.Line(end+1)) {
+				end++
+			}
+		}
+		return viRange{start: Loc{0, start}, end: Loc{0, end}, linewise: true}, true
+	}
+
+	var open, close rune
+	for _, bp := range bracePairs {
+		if obj == bp[0] || obj == bp[1] {
+			open, close = bp[0], bp[1]
+		}
+	}
+	switch obj {
+	case 'b':
+		open, close = '(', ')'
+	case 'B':
+		open, close = '{', '}'
+	}
+	if open == 0 {
+		return viRange{}, false
+	}
+
+	// Look back for the bracket that encloses the cursor
+	loc, ok := c, true
+	if b.viAt(loc) == close {
+		loc, ok = b.viPrev(loc)
+	}
+	depth := 0
+	for ok {
+		if r := b.viAt(loc); r == close {
+			depth++
+		} else if r == open {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+		loc, ok = b.viPrev(loc)
+	}
+	if !ok {
+		return viRange{}, false
+	}
+	end, found := v.FindMatchingBrace(loc)
+	if !found {
+		return viRange{}, false
+	}
+	if !inner {
+		end, _ = b.viNext(end)
+		return viRange{start: loc, end: end}, true
+	}
+	start, _ := b.viNext(loc)
+	if start.X == Count(b.Line(start.Y)) && end.Y > start.Y+1 && end.X == b.viFirstNonBlank(end.Y) {
+		// The brackets end and start their lines, so the lines between them
+		// are taken whole
+		return viRange{start: Loc{0, start.Y + 1}, end: Loc{0, end.Y - 1}, linewise: true}, true
+	}
+	return viRange{start: start, end: end}, true
+}
+
+// viOperatorRange returns the text an operator command applies to
+func (v *View) viOperatorRange(cmd viCommand) (viRange, bool) {
+	if k := []rune(cmd.key); len(k) == 2 && (k[0] == 'i' || k[0] == 'a') {
+		return v.viTextObject(cmd.key)
+	}
+	target, linewise, inclusive, ok := v.viMotion(cmd)
+	if !ok {
+		return viRange{}, false
+	}
+	start, end := v.Cursor.Loc, target
+	if end.LessThan(start) {
+		start, end = end, start
+	}
+	if linewise {
+		return viRange{start: start, end: end, linewise: true}, true
+	}
+	if inclusive {
+		end, _ = v.Buf.viNext(end)
+	}
+	return viRange{start: start, end: end}, start != end
+}
+
+// viYank puts text in the unnamed register and in reg if one was given
+func (v *View) viYank(reg rune, text string, linewise bool) {
+	switch {
+	case reg >= 'a' && reg <= 'z':
+		if linewise && !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		registers[reg] = text
+	case reg == '+' || reg == '*':
+		WriteClipboard(text)
+	}
+	v.vi.register, v.vi.linewise = text, linewise
+	pushKill(text)
+}
+
+// viDeleteLines deletes lines y1 to y2
+func (v *View) viDeleteLines(y1, y2 int) {
+	b := v.Buf
+	switch {
+	case y2 < b.NumLines-1:
+		b.Remove(Loc{0, y1}, Loc{0, y2 + 1})
+	case y1 > 0:
+		b.Remove(Loc{Count(b.Line(y1 - 1)), y1 - 1}, Loc{Count(b.Line(y2)), y2})
+	default:
+		b.Remove(Loc{0, 0}, Loc{Count(b.Line(y2)), y2})
+	}
+	y := Min(y1, b.NumLines-1)
+	v.Cursor.Loc = Loc{b.viFirstNonBlank(y), y}
+}
+
+// viShift indents lines y1 to y2 count times with > or outdents them with <
+func (v *View) viShift(op rune, y1, y2, count int) {
+	for i := 0; i < count; i++ {
+		v.Cursor.SetSelectionStart(Loc{0, y1})
+		v.Cursor.SetSelectionEnd(Loc{Count(v.Buf.Line(y2)), y2})
+		if op == '>' {
+			v.IndentSelection()
+		} else {
+			v.OutdentSelection()
+		}
+	}
+	v.Cursor.ResetSelection()
+	v.Cursor.Loc = Loc{v.Buf.viFirstNonBlank(y1), y1}
+}
+
+// viOperate applies an operator to a range of text
+func (v *View) viOperate(op rune, r viRange, reg rune, count int) {
+	b := v.Buf
+	if r.linewise {
+		y1, y2 := r.start.Y, r.end.Y
+		text := b.Substr(Loc{0, y1}, Loc{Count(b.Line(y2)), y2}) + "\n"
+		switch op {
+		case 'y':
+			v.viYank(reg, text, true)
+			v.Cursor.Y = y1
+		case 'd':
+			v.viYank(reg, text, true)
+			v.viDeleteLines(y1, y2)
+		case 'c':
+			v.viYank(reg, text, true)
+			indent := GetLeadingWhitespace(b.Line(y1))
+			b.Replace(Loc{0, y1}, Loc{Count(b.Line(y2)), y2}, indent)
+			v.Cursor.Loc = Loc{Count(indent), y1}
+			v.viInsert()
+		case '>', '<':
+			v.viShift(op, y1, y2, count)
+		}
+		return
+	}
+
+	text := b.Substr(r.start, r.end)
+	switch op {
+	case 'y':
+		v.viYank(reg, text, false)
+		v.Cursor.Loc = r.start
+	case 'd', 'c':
+		v.viYank(reg, text, false)
+		b.Remove(r.start, r.end)
+		v.Cursor.Loc = r.start
+		if op == 'c' {
+			v.viInsert()
+		}
+	case '>', '<':
+		y2 := r.end.Y
+		if r.end.X == 0 && y2 > r.start.Y {
+			y2--
+		}
+		v.viShift(op, r.start.Y, y2, count)
+	}
+}
+
+// viPut pastes the unnamed register, or reg if one was given, after the
+// cursor or before it
+func (v *View) viPut(reg rune, before bool, count int) {
+	b := v.Buf
+	text, linewise := v.vi.register, v.vi.linewise
+	switch {
+	case reg >= 'a' && reg <= 'z':
+		text = registers[reg]
+		linewise = strings.HasSuffix(text, "\n")
+	case reg == '+' || reg == '*':
+		text = ReadClipboard()
+		linewise = strings.HasSuffix(text, "\n")
+	}
+	if text == "" {
+		return
+	}
+	text = strings.Repeat(text, count)
+
+	y := v.Cursor.Y
+	if linewise {
+		switch {
+		case before:
+			b.Insert(Loc{0, y}, text)
+		case y+1 < b.NumLines:
+			y++
+			b.Insert(Loc{0, y}, text)
+		default:
+			b.Insert(Loc{Count(b.Line(y)), y}, "\n"+strings.TrimSuffix(text, "\n"))
+			y++
+		}
+		v.Cursor.Loc = Loc{b.viFirstNonBlank(y), y}
+		return
+	}
+	loc := v.Cursor.Loc
+	if !before && loc.X < Count(b.Line(y)) {
+		loc.X++
+	}
+	b.Insert(loc, text)
+	v.Cursor.Loc = loc.Move(Count(text)-1, b)
+}
+
+// viJoin joins count lines from line y, putting a space between them
+func (v *View) viJoin(y, count int) {
+	b := v.Buf
+	for i := 1; i < Max(count, 2) && y+1 < b.NumLines; i++ {
+		line, next := b.Line(y), b.Line(y+1)
+		rest := strings.TrimLeft(next, " \t")
+		sep := " "
+		if rest == "" || line == "" || strings.HasSuffix(line, " ") || strings.HasPrefix(rest, ")") {
+			sep = ""
+		}
+		x := Count(line)
+		b.Replace(Loc{x, y}, Loc{Count(next) - Count(rest), y + 1}, sep)
+		v.Cursor.Loc = Loc{x, y}
+	}
+}
+
+// viChangeCase toggles the case of the text from start to end
+func (v *View) viChangeCase(start, end Loc, change func(rune) rune) {
+	text := v.Buf.Substr(start, end)
+	changed := strings.Map(change, text)
+	if changed != text {
+		v.Buf.Replace(start, end, changed)
+	}
+}
+
+func toggleCase(r rune) rune {
+	if unicode.IsUpper(r) {
+		return unicode.ToLower(r)
+	}
+	return unicode.ToUpper(r)
+}
+
+// viMove moves the cursor with a motion in normal or visual mode
+func (v *View) viMove(cmd viCommand) bool {
+	count := Max(cmd.count, 1)
+	switch cmd.key {
+	case "j", "k":
+		if cmd.key == "j" {
+			count = -count
+		}
+		v.cursorUpN(count)
+		return true
+	}
+	k := []rune(cmd.key)
+	target, _, _, ok := v.viMotion(cmd)
+	if !ok {
+		return len(k) > 0 && strings.ContainsRune("hl $0^wWbBeEG%{};,fFtT`'\r+-_", k[0]) || cmd.key == "gg"
+	}
+	switch k[0] {
+	case 'g', 'G', '%', '{', '}', '`', '\'':
+		v.recordJump()
+	}
+	v.Cursor.Loc = target
+	v.Cursor.LastVisualX = v.Cursor.GetVisualX()
+	return true
+}
+
+// viExecute runs a parsed command. events are the key events it was typed
+// with, which . replays if the command changes the buffer
+func (v *View) viExecute(cmd viCommand, events []tcell.Event) {
+	if v.vi.mode != ViNormal {
+		v.viVisualCommand(cmd)
+		return
+	}
+	count := Max(cmd.count, 1)
+
+	if cmd.op != 0 {
+		r, ok := v.viOperatorRange(cmd)
+		if !ok {
+			return
+		}
+		if cmd.op == 'y' {
+			v.viOperate(cmd.op, r, cmd.register, 1)
+			return
+		}
+		v.viBeginChange(events)
+		v.viOperate(cmd.op, r, cmd.register, 1)
+		v.viEndChange()
+		return
+	}
+	if v.viMove(cmd) {
+		return
+	}
+
+	b := v.Buf
+	c := v.Cursor.Loc
+	change := func() {
+		v.viBeginChange(events)
+	}
+	switch key := []rune(cmd.key); key[0] {
+	case 'i':
+		change()
+		v.viInsert()
+	case 'a':
+		change()
+		if c.X < Count(b.Line(c.Y)) {
+			v.Cursor.X++
+		}
+		v.viInsert()
+	case 'I':
+		change()
+		v.Cursor.X = b.viFirstNonBlank(c.Y)
+		v.viInsert()
+	case 'A':
+		change()
+		v.Cursor.X = Count(b.Line(c.Y))
+		v.viInsert()
+	case 'o':
+		change()
+		indent := GetLeadingWhitespace(b.Line(c.Y))
+		b.Insert(Loc{Count(b.Line(c.Y)), c.Y}, "\n"+indent)
+		v.Cursor.Loc = Loc{Count(indent), c.Y + 1}
+		v.viInsert()
+	case 'O':
+		change()
+		indent := GetLeadingWhitespace(b.Line(c.Y))
+		b.Insert(Loc{0, c.Y}, indent+"\n")
+		v.Cursor.Loc = Loc{Count(indent), c.Y}
+		v.viInsert()
+	case 'r':
+		if c.X+count > Count(b.Line(c.Y)) {
+			return
+		}
+		change()
+		if key[1] == '\r' {
+			b.Replace(c, Loc{c.X + count, c.Y}, "\n")
+			v.Cursor.Loc = Loc{0, c.Y + 1}
+		} else {
+			b.Replace(c, Loc{c.X + count, c.Y}, strings.Repeat(string(key[1]), count))
+			v.Cursor.X = c.X + count - 1
+		}
+	case 'J':
+		change()
+		v.viJoin(c.Y, count)
+	case 'p', 'P':
+		change()
+		v.viPut(cmd.register, key[0] == 'P', count)
+	case '~':
+		end := Loc{Min(c.X+count, Count(b.Line(c.Y))), c.Y}
+		if end == c {
+			return
+		}
+		change()
+		v.viChangeCase(c, end, toggleCase)
+		v.Cursor.Loc = end
+	case 'u':
+		for i := 0; i < count; i++ {
+			v.Undo()
+		}
+		return
+	case rune(tcell.KeyCtrlR):
+		for i := 0; i < count; i++ {
+			v.Redo()
+		}
+		return
+	case ':':
+		v.CommandMode()
+		return
+	case '.':
+		repeat := v.vi.lastChange
+		for i := 0; i < count; i++ {
+			for _, e := range repeat {
+				v.HandleEvent(e)
+			}
+		}
+		return
+	case 'v', 'V':
+		v.vi.mode = ViVisual
+		if key[0] == 'V' {
+			v.vi.mode = ViVisualLine
+		}
+		v.vi.visualStart = c
+		return
+	case 'n':
+		// Search from after the cursor so the match under it is skipped
+		v.Cursor.SetSelectionStart(c)
+		v.Cursor.SetSelectionEnd(c.Move(1, b))
+		v.FindNext()
+		return
+	case 'N':
+		v.FindPrevious()
+		return
+	case '/', '?':
+		v.Find()
+		return
+	case 'm':
+		if key[1] >= 'a' && key[1] <= 'z' {
+			b.setMark(key[1], c)
+			b.marksChanged()
+		}
+		return
+	case 'g', 'z', 'Z':
+		v.viPrefixCommand(cmd.key)
+		return
+	case rune(tcell.KeyCtrlO):
+		v.JumpBack()
+		return
+	case rune(tcell.KeyTab):
+		v.JumpForward()
+		return
+	case rune(tcell.KeyCtrlD), rune(tcell.KeyCtrlU):
+		n := Max(v.Height/2, 1)
+		if key[0] == rune(tcell.KeyCtrlD) {
+			n = -n
+		}
+		v.cursorUpN(n)
+		return
+	default:
+		return
+	}
+	v.viEndChange()
+}
+
+// viPrefixCommand runs the two key commands that start with g, z or Z which
+// are not motions
+func (v *View) viPrefixCommand(key string) {
+	switch key {
+	case "zc":
+		v.Fold()
+	case "zo":
+		v.Unfold()
+	case "za":
+		v.ToggleFold()
+	case "zM":
+		v.FoldAll()
+	case "zR":
+		v.UnfoldAll()
+	case "ZZ":
+		v.Save()
+		if !v.Buf.IsModified {
+			v.Quit()
+		}
+	}
+}
+
+// viVisualCommand runs a command in visual mode, where operators apply to
+// the selection
+func (v *View) viVisualCommand(cmd viCommand) {
+	count := Max(cmd.count, 1)
+	key := []rune(cmd.key)
+
+	if len(key) == 2 && (key[0] == 'i' || key[0] == 'a') {
+		if r, ok := v.viTextObject(cmd.key); ok {
+			if r.linewise {
+				v.vi.mode = ViVisualLine
+				v.vi.visualStart = r.start
+				v.Cursor.Loc = Loc{0, r.end.Y}
+			} else {
+				v.vi.visualStart = r.start
+				v.Cursor.Loc, _ = v.Buf.viPrev(r.end)
+			}
+		}
+		return
+	}
+	if v.viMove(cmd) {
+		return
+	}
+
+	start, end := v.vi.visualStart, v.Cursor.Loc
+	if end.LessThan(start) {
+		start, end = end, start
+	}
+	r := viRange{start: start, end: end, linewise: v.vi.mode == ViVisualLine}
+	if !r.linewise {
+		r.end, _ = v.Buf.viNext(end)
+	}
+	linewise := r
+	linewise.linewise = true
+
+	operate := func(op rune, r viRange) {
+		v.Buf.BeginGroup()
+		v.vi.mode = ViNormal
+		v.Cursor.ResetSelection()
+		v.viOperate(op, r, cmd.register, count)
+		v.Buf.EndGroup()
+	}
+	switch key[0] {
+	case 'd', 'x', 'y', 'c', 's':
+		op := map[rune]rune{'d': 'd', 'x': 'd', 'y': 'y', 'c': 'c', 's': 'c'}[key[0]]
+		operate(op, r)
+	case 'D', 'X', 'Y', 'C', 'S', 'R':
+		op := map[rune]rune{'D': 'd', 'X': 'd', 'Y': 'y', 'C': 'c', 'S': 'c', 'R': 'c'}[key[0]]
+		operate(op, linewise)
+	case '>', '<':
+		operate(key[0], linewise)
+	case '~', 'u', 'U':
+		change := map[rune]func(rune) rune{'~': toggleCase, 'u': unicode.ToLower, 'U': unicode.ToUpper}[key[0]]
+		if r.linewise {
+			r.start.X = 0
+			r.end = v.Buf.viLineEnd(r.end.Y)
+		}
+		v.viChangeCase(r.start, r.end, change)
+		v.viExitVisual()
+		v.Cursor.Loc = start
+	case 'J':
+		v.Buf.BeginGroup()
+		v.viJoin(start.Y, Max(end.Y-start.Y+1, 2))
+		v.Buf.EndGroup()
+		v.viExitVisual()
+	case 'o':
+		v.vi.visualStart, v.Cursor.Loc = v.Cursor.Loc, v.vi.visualStart
+	case 'v':
+		if v.vi.mode == ViVisual {
+			v.viExitVisual()
+		} else {
+			v.vi.mode = ViVisual
+		}
+	case 'V':
+		if v.vi.mode == ViVisualLine {
+			v.viExitVisual()
+		} else {
+			v.vi.mode = ViVisualLine
+		}
+	case 'g', 'z', 'Z':
+		v.viPrefixCommand(cmd.key)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dgv/zed/tcell"
+)
+
+func newViTestView(text string) *View {
+	b := NewBufferFromString(text, "")
+	v := &View{Buf: b, Cursor: &b.Cursor, Width: 40, Height: 10, cellview: new(CellView)}
+	messenger = &Messenger{history: map[string][]string{}}
+	views = []*View{v}
+	globalSettings["keymap"] = "vi"
+	globalSettings["clipboard"] = "internal"
+	InitClipboard()
+	loadBindings()
+	return v
+}
+
+// Keys that are a single multi-byte rune mustn't be taken for a motion with
+// an argument
+func TestViMultiByteKey(t *testing.T) {
+	v := newViTestView("süß über")
+	for _, r := range "ü€fß" {
+		v.HandleEvent(tcell.NewEventKey(tcell.KeyRune, r, 0))
+	}
+	if v.Buf.String() != "süß über" || v.Cursor.Loc != (Loc{2, 0}) {
+		t.Fatalf("got %q with the cursor at %v", v.Buf.String(), v.Cursor.Loc)
+	}
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"strings"
-	"time"
+	"unicode"
 
 	"github.com/dgv/zed/tcell"
 )
@@ -33,13 +34,37 @@ type View struct {
 	// The buffer
 	Buf *Buffer
 
-	// lastCutTime stores when the last ctrl+k was issued.
-	// It is used for clearing the clipboard to replace it with fresh cut lines.
-	lastCutTime time.Time
+	// killed is set by the kill actions. appendKills tells the kill actions
+	// whether the key before the one being handled killed too, as only
+	// consecutive kills accumulate in the clipboard
+	killed      bool
+	appendKills bool
 
 	// freshClip returns true if the clipboard has never been pasted.
 	freshClip bool
 
+	// autoClose stores the locations of closing characters that were
+	// inserted by auto-pairing and can be typed over
+	autoClose []Loc
+
+	// The completion popup, nil if it is closed
+	completion *Completion
+
+	// The snippet whose fields are being filled in, if any
+	snippet *SnippetSession
+
+	// The folded ranges of lines
+	folds []*Fold
+
+	// Positions the cursor jumped from, and where in them JumpBack and
+	// JumpForward are. jumping is set while they open another buffer
+	jumps     []jump
+	jumpIndex int
+	jumping   bool
+
+	// The state of the vi keymap
+	vi ViState
+
 	cellview *CellView
 }
 
@@ -130,11 +155,19 @@ func (v *View) CanClose() bool {
 // This resets the topline, event handler and cursor.
 func (v *View) OpenBuffer(buf *Buffer) {
 	screen.Clear()
+	if v.Buf != nil {
+		v.recordJump()
+		v.UnfoldAll()
+		v.viReset()
+	}
 	v.Buf = buf
 	v.Cursor = &buf.Cursor
 	v.Topline = 0
 	v.leftCol = 0
 	v.Cursor.ResetSelection()
+	v.autoClose = nil
+	v.completion = nil
+	v.endSnippet()
 	v.Relocate()
 	v.Center()
 }
@@ -176,44 +209,35 @@ func (v *View) ReOpen() {
 	}
 }
 
+// Bottomline returns the line after the last one that fits in the view
 func (v *View) Bottomline() int {
-	screenX, screenY := 0, 0
-	numLines := 0
-	for lineN := v.Topline; lineN < v.Topline+v.Height; lineN++ {
-		line := v.Buf.Line(lineN)
-
-		colN := 0
-		for _, ch := range line {
-			if screenX >= v.Width-v.lineNumOffset {
-				screenX = 0
-				screenY++
-			}
-
-			if ch == '\t' {
-				screenX += *flagTabSize - 1
-			}
-
-			screenX++
-			colN++
-		}
-		screenX = 0
-		screenY++
-		numLines++
-
-		if screenY >= v.Height {
+	if !v.Buf.BoolOption("softwrap") && len(v.folds) == 0 {
+		return v.Topline + v.Height
+	}
+	rows := 0
+	lineN := v.Topline
+	for ; lineN < v.Buf.NumLines; lineN++ {
+		rows += len(v.lineRows(lineN))
+		if rows > v.Height {
 			break
 		}
 	}
-	return numLines + v.Topline
+	return lineN
 }
 
 // Relocate moves the view window so that the cursor is in view
 // This is useful if the user has scrolled far away, and then starts typing
 func (v *View) Relocate() bool {
+	v.pruneFolds()
+	v.lineNumOffset = v.gutterWidth()
+	if v.Buf.BoolOption("softwrap") || len(v.folds) > 0 {
+		return v.relocateRows()
+	}
+
 	height := v.Bottomline() - v.Topline
 	ret := false
 	cy := v.Cursor.Y
-	scrollmargin := 0
+	scrollmargin := IntOption("scrollmargin")
 	if cy < v.Topline+scrollmargin && cy > scrollmargin-1 {
 		v.Topline = cy - scrollmargin
 		ret = true
@@ -242,6 +266,39 @@ func (v *View) Relocate() bool {
 	return ret
 }
 
+// relocateRows is Relocate for soft wrapping and folding, where lines can
+// take up more or less than one row
+func (v *View) relocateRows() bool {
+	ret := false
+	if v.Buf.BoolOption("softwrap") && v.leftCol != 0 {
+		v.leftCol = 0
+		ret = true
+	}
+	if v.Cursor.Y < v.Topline {
+		v.Topline = v.Cursor.Y
+		ret = true
+	}
+	rows := v.rowsBefore(v.Cursor.Loc)
+	for rows >= v.Height && v.Topline < v.Cursor.Y {
+		rows -= len(v.lineRows(v.Topline))
+		v.Topline = v.nextVisibleLine(v.Topline, 1)
+		ret = true
+	}
+
+	if !v.Buf.BoolOption("softwrap") {
+		cx := v.Cursor.GetVisualX()
+		if cx < v.leftCol {
+			v.leftCol = cx
+			ret = true
+		}
+		if cx+v.lineNumOffset+1 > v.leftCol+v.Width {
+			v.leftCol = cx - v.Width + v.lineNumOffset + 1
+			ret = true
+		}
+	}
+	return ret
+}
+
 func (v *View) ExecuteActions(actions []func(*View) bool) bool {
 	relocate := false
 	//readonlyBindingsList := []string{"Delete", "Insert", "Backspace", "Cut", "Play", "Paste", "Move", "Add", "DuplicateLine", "Macro"}
@@ -264,52 +321,66 @@ func (v *View) HandleEvent(event tcell.Event) {
 
 	v.Buf.CheckModTime()
 
+	switch event.(type) {
+	case *tcell.EventKey, *tcell.EventPaste:
+		// Keys that continue a sequence belong to the same command
+		if pendingNode == nil {
+			v.appendKills, v.killed = v.killed, false
+		}
+	}
+
+	cy := v.Cursor.Y
+
 	switch e := event.(type) {
 	case *tcell.EventKey:
-		// Check first if input is a key binding, if it is we 'eat' the input and don't insert a rune
-		isBinding := false
-		for key, actions := range bindings {
-			if e.Key() == key.keyCode {
-				if e.Key() == tcell.KeyRune {
-					if e.Rune() != key.r {
-						continue
-					}
-				}
-				if e.Modifiers() == key.modifiers {
-					relocate = false
-					isBinding = true
-					relocate = v.ExecuteActions(actions)
-					break
-				}
-			}
+		completion := v.completion
+		if completion != nil && v.handleCompletionKey(e) {
+			break
 		}
-		if !isBinding && e.Key() == tcell.KeyRune {
-			// Check viewtype if readonly don't insert a rune (readonly help and log view etc.)
+		if viEnabled() && v.viHandleKey(e) {
+			break
+		}
+
+		// Check first if input is a key binding, if it is we 'eat' the input and don't insert a rune
+		var isBinding bool
+		isBinding, relocate = v.handleBindingKey(e)
+		if !isBinding && e.Key() == tcell.KeyRune && !v.Buf.ReadOnly && !v.autoPair(e.Rune()) {
 			// Insert a character
 			if v.Cursor.HasSelection() {
 				v.Cursor.DeleteSelection()
 				v.Cursor.ResetSelection()
 			}
+			v.shiftAutoClose(v.Cursor.Y, v.Cursor.X, 1)
 			v.Buf.Insert(v.Cursor.Loc, string(e.Rune()))
 			v.Cursor.Right()
+			if v.Buf.BoolOption("autowrap") && !unicode.IsSpace(e.Rune()) {
+				v.autoWrap()
+			}
 		}
+		v.completionKeyDone(e, isBinding, completion)
 	case *tcell.EventPaste:
+		v.viRecordPaste(e)
 		v.paste(e.Text())
+	case *keyTimeoutEvent:
+		relocate = v.keyTimeout(e)
 
 	}
 
+	v.updateSnippet()
+
+	// Auto-inserted closers can only be typed over while the cursor stays on their line
+	if v.Cursor.Y != cy {
+		v.autoClose = nil
+	}
+
 	if relocate {
 		v.Relocate()
-		// We run relocate again because there's a bug with relocating with softwrap
-		// when for example you jump to the bottom of the buffer and it tries to
-		// calculate where to put the topline so that the bottom line is at the bottom
-		// of the terminal and it runs into problems with visual lines vs real lines.
-		// This is (hopefully) a temporary solution
-		//v.Relocate()
 	}
 }
 
 func (v *View) DisplayView() {
+	v.Topline = v.visibleLine(v.Topline)
+	v.lineNumOffset = v.gutterWidth()
 	xOffset := v.x + v.lineNumOffset
 	yOffset := v.y
 
@@ -318,23 +389,24 @@ func (v *View) DisplayView() {
 	left := v.leftCol
 	top := v.Topline
 
-	v.cellview.Draw(v.Buf, top, height, left, width-v.lineNumOffset)
+	v.cellview.Draw(v.Buf, top, height, left, width-v.lineNumOffset, v.Buf.BoolOption("softwrap"), v.lineAfter)
 
-	//screenX := v.x
-	realLineN := top - 1
-	visualLineN := 0
-	var line []*Char
-	for visualLineN, line = range v.cellview.lines {
-		var firstChar *Char
-		if len(line) > 0 {
-			firstChar = line[0]
-		}
+	braceMatch, hasBraceMatch := v.matchingBrace()
+
+	for visualLineN, line := range v.cellview.lines {
+		row := v.cellview.rows[visualLineN]
+		realLineN := row.line
 
-		//var softwrapped bool
-		if firstChar != nil {
-			realLineN = firstChar.realLoc.Y
-		} else {
-			realLineN++
+		for x := 0; x < v.lineNumOffset; x++ {
+			gutterChar := ' '
+			if x == 0 && row.wrapped {
+				gutterChar = softWrapMarker
+			} else if x == 0 && row.folded > 0 {
+				gutterChar = foldMarker
+			} else if x == 0 && v.Buf.IsBookmarked(row.line) {
+				gutterChar = bookmarkMarker
+			}
+			screen.SetContent(v.x+x, yOffset+visualLineN, gutterChar, nil, defStyle)
 		}
 
 		var lastChar *Char
@@ -349,6 +421,8 @@ func (v *View) DisplayView() {
 						charLoc.LessThan(v.Cursor.CurSelection[0]) && charLoc.GreaterEqual(v.Cursor.CurSelection[1])) {
 					// The current character is selected
 					lineStyle = defStyle.Reverse(true)
+				} else if hasBraceMatch && charLoc == braceMatch {
+					lineStyle = lineStyle.Underline(true).Bold(true)
 				}
 
 				if !v.Cursor.HasSelection() &&
@@ -363,6 +437,21 @@ func (v *View) DisplayView() {
 			}
 		}
 
+		if !row.last {
+			// The rest of the line is on the next row
+			continue
+		}
+		if row.folded > 0 {
+			summaryX := xOffset
+			if lastChar != nil {
+				summaryX += lastChar.visualLoc.X + lastChar.width
+			}
+			summary := []rune(fmt.Sprintf(" … %d lines", row.folded))
+			for i := 0; i < len(summary) && summaryX+i < v.x+v.Width; i++ {
+				screen.SetContent(summaryX+i, yOffset+visualLineN, summary[i], nil, defStyle.Dim(true))
+			}
+		}
+
 		lastX := 0
 		var realLoc Loc
 		var visualLoc Loc
@@ -375,12 +464,11 @@ func (v *View) DisplayView() {
 			realLoc = Loc{lastChar.realLoc.X + 1, realLineN}
 			visualLoc = Loc{lastX - xOffset, lastChar.visualLoc.Y}
 		} else if len(line) == 0 {
-			if !v.Cursor.HasSelection() &&
-				v.Cursor.Y == realLineN {
+			realLoc = Loc{row.start, realLineN}
+			if !v.Cursor.HasSelection() && v.Cursor.Loc == realLoc {
 				screen.ShowCursor(xOffset, yOffset+visualLineN)
 			}
 			lastX = xOffset
-			realLoc = Loc{0, realLineN}
 			visualLoc = Loc{0, visualLineN}
 		}
 
@@ -397,8 +485,9 @@ func (v *View) DisplayView() {
 // Display renders the view, the cursor, and statusline
 func (v *View) Display() {
 	v.DisplayView()
+	v.displayCompletion()
 	// Don't draw the cursor if it is out of the viewport or if it has a selection
-	if v.Cursor.Y-v.Topline < 0 || v.Cursor.Y-v.Topline > v.Height-1 || v.Cursor.HasSelection() {
+	if v.Cursor.Y < v.Topline || v.rowsBefore(v.Cursor.Loc) > v.Height-1 || v.Cursor.HasSelection() {
 		screen.HideCursor()
 	}
 
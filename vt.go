@@ -0,0 +1,604 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dgv/zed/runewidth"
+	"github.com/dgv/zed/tcell"
+)
+
+// maxScrollback is how many lines that scrolled off the top of a terminal
+// are kept
+const maxScrollback = 10000
+
+// A vtCell is a character on a terminal's screen. The second column of a
+// wide character holds a cell with no rune
+type vtCell struct {
+	r     rune
+	style tcell.Style
+}
+
+// The states of the parser of what programs print to a terminal
+const (
+	vtGround = iota
+	vtEscape
+	vtCSI
+	vtString
+	vtStringEscape
+	vtCharset
+)
+
+// A VT emulates the parts of an xterm that shells and full screen programs
+// use, keeping what it would show. Programs print to it through Write, and
+// replies to their queries go to reply. Only text attributes are kept, not
+// colors, so the shell is told it runs in an xterm without them
+type VT struct {
+	Width, Height int
+
+	lines      [][]vtCell
+	scrollback [][]vtCell
+	// The main screen while the alternate screen is shown
+	mainLines [][]vtCell
+	altScreen bool
+
+	cx, cy int
+	// Set after printing to the last column, so the next character goes on
+	// the next line
+	wrapNext bool
+	style    tcell.Style
+
+	savedX, savedY int
+	savedStyle     tcell.Style
+
+	// The scrolling region, from top to bottom inclusive
+	top, bottom int
+
+	autowrap       bool
+	cursorVisible  bool
+	appCursor      bool
+	bracketedPaste bool
+
+	state   int
+	seq     []byte
+	partial []byte
+
+	reply func([]byte)
+}
+
+// NewVT returns a terminal of the given size showing an empty screen
+func NewVT(w, h int, reply func([]byte)) *VT {
+	t := &VT{reply: reply}
+	t.Resize(w, h)
+	t.reset()
+	return t
+}
+
+// reset puts the terminal back in the state it starts in, clearing the screen
+func (t *VT) reset() {
+	t.altScreen, t.mainLines = false, nil
+	t.style = tcell.StyleDefault
+	t.top, t.bottom = 0, t.Height-1
+	t.autowrap, t.cursorVisible = true, true
+	t.appCursor, t.bracketedPaste = false, false
+	t.state = vtGround
+	t.eraseLines(0, t.Height)
+	t.moveTo(0, 0)
+}
+
+func (t *VT) blankLine() []vtCell {
+	line := make([]vtCell, t.Width)
+	for i := range line {
+		line[i] = vtCell{' ', tcell.StyleDefault}
+	}
+	return line
+}
+
+// Resize changes the size of the screen. Lines cut off at the top go to the
+// scrollback
+func (t *VT) Resize(w, h int) {
+	w, h = Max(w, 1), Max(h, 1)
+	if w == t.Width && h == t.Height {
+		return
+	}
+	for i, line := range t.lines {
+		t.lines[i] = resizeLine(line, w)
+	}
+	for i, line := range t.mainLines {
+		t.mainLines[i] = resizeLine(line, w)
+	}
+	t.Width = w
+
+	// Keep the cursor on the screen by scrolling the lines above it away
+	if extra := t.cy + 1 - h; extra > 0 {
+		if !t.altScreen {
+			t.pushScrollback(t.lines[:extra])
+		}
+		t.lines = t.lines[extra:]
+		t.cy -= extra
+	}
+	for len(t.lines) > h {
+		t.lines = t.lines[:h]
+	}
+	for len(t.lines) < h {
+		t.lines = append(t.lines, t.blankLine())
+	}
+	if t.mainLines != nil {
+		for len(t.mainLines) > h {
+			t.mainLines = t.mainLines[1:]
+		}
+		for len(t.mainLines) < h {
+			t.mainLines = append(t.mainLines, t.blankLine())
+		}
+	}
+	t.Height = h
+
+	t.top, t.bottom = 0, h-1
+	t.moveTo(t.cx, t.cy)
+	t.savedX, t.savedY = Min(t.savedX, w-1), Min(t.savedY, h-1)
+}
+
+func resizeLine(line []vtCell, w int) []vtCell {
+	if len(line) >= w {
+		return line[:w]
+	}
+	for len(line) < w {
+		line = append(line, vtCell{' ', tcell.StyleDefault})
+	}
+	return line
+}
+
+func (t *VT) pushScrollback(lines [][]vtCell) {
+	t.scrollback = append(t.scrollback, lines...)
+	if extra := len(t.scrollback) - maxScrollback; extra > 0 {
+		t.scrollback = append(t.scrollback[:0], t.scrollback[extra:]...)
+	}
+}
+
+// Line returns the nth line of the scrollback followed by the screen
+func (t *VT) Line(n int) []vtCell {
+	if n < len(t.scrollback) {
+		return t.scrollback[n]
+	}
+	return t.lines[n-len(t.scrollback)]
+}
+
+// NumLines returns how many lines the scrollback and the screen hold
+func (t *VT) NumLines() int {
+	return len(t.scrollback) + len(t.lines)
+}
+
+// Text returns the scrollback and the screen as text, without the blank
+// lines at the end
+func (t *VT) Text() string {
+	lines := make([]string, t.NumLines())
+	for i := range lines {
+		var s strings.Builder
+		for _, c := range t.Line(i) {
+			if c.r != 0 {
+				s.WriteRune(c.r)
+			}
+		}
+		lines[i] = strings.TrimRight(s.String(), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Write handles what a program printed to the terminal
+func (t *VT) Write(data []byte) {
+	if len(t.partial) > 0 {
+		data = append(t.partial, data...)
+		t.partial = nil
+	}
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && !utf8.FullRune(data) {
+			// The rest of the character comes with the next write
+			t.partial = append([]byte{}, data...)
+			return
+		}
+		data = data[size:]
+		t.handle(r)
+	}
+}
+
+func (t *VT) handle(r rune) {
+	switch t.state {
+	case vtGround:
+		if r < ' ' || r == 0x7f {
+			t.control(r)
+		} else {
+			t.put(r)
+		}
+	case vtEscape:
+		t.state = vtGround
+		t.escape(r)
+	case vtCSI:
+		switch {
+		case r >= 0x40 && r <= 0x7e:
+			t.state = vtGround
+			t.csi(string(t.seq), r)
+		case r == 0x1b:
+			t.state = vtEscape
+		case r < ' ':
+			t.control(r)
+		case len(t.seq) < 256:
+			t.seq = append(t.seq, byte(r))
+		}
+	case vtString:
+		// The strings of OSC and DCS sequences, such as window titles, are
+		// ignored
+		if r == 0x07 {
+			t.state = vtGround
+		} else if r == 0x1b {
+			t.state = vtStringEscape
+		}
+	case vtStringEscape:
+		t.state = vtGround
+	case vtCharset:
+		t.state = vtGround
+	}
+}
+
+// control handles a control character
+func (t *VT) control(r rune) {
+	switch r {
+	case 0x1b:
+		t.state = vtEscape
+	case '\r':
+		t.cx, t.wrapNext = 0, false
+	case '\n', '\v', '\f':
+		t.lineFeed()
+	case '\b':
+		t.moveTo(t.cx-1, t.cy)
+	case '\t':
+		t.moveTo(Min((t.cx/8+1)*8, t.Width-1), t.cy)
+	}
+}
+
+// escape handles the character after an escape
+func (t *VT) escape(r rune) {
+	switch r {
+	case '[':
+		t.state, t.seq = vtCSI, t.seq[:0]
+	case ']', 'P', '_', '^':
+		t.state = vtString
+	case '(', ')', '*', '+':
+		t.state = vtCharset
+	case '7':
+		t.saveCursor()
+	case '8':
+		t.restoreCursor()
+	case 'D':
+		t.lineFeed()
+	case 'E':
+		t.cx = 0
+		t.lineFeed()
+	case 'M':
+		t.reverseIndex()
+	case 'c':
+		t.reset()
+	}
+}
+
+// put prints a character at the cursor
+func (t *VT) put(r rune) {
+	width := runewidth.RuneWidth(r)
+	if width == 0 || width > t.Width {
+		return
+	}
+	if t.wrapNext || t.cx+width > t.Width {
+		if t.autowrap {
+			t.cx = 0
+			t.lineFeed()
+		} else {
+			t.cx = t.Width - width
+		}
+	}
+	line := t.lines[t.cy]
+	line[t.cx] = vtCell{r, t.style}
+	if width == 2 {
+		line[t.cx+1] = vtCell{0, t.style}
+	}
+	t.cx += width
+	t.wrapNext = false
+	if t.cx >= t.Width {
+		t.cx = t.Width - 1
+		t.wrapNext = true
+	}
+}
+
+func (t *VT) lineFeed() {
+	if t.cy == t.bottom {
+		t.scrollUp(t.top, t.bottom, 1)
+	} else if t.cy < t.Height-1 {
+		t.cy++
+	}
+	t.wrapNext = false
+}
+
+func (t *VT) reverseIndex() {
+	if t.cy == t.top {
+		t.scrollDown(t.top, t.bottom, 1)
+	} else if t.cy > 0 {
+		t.cy--
+	}
+	t.wrapNext = false
+}
+
+// scrollUp moves lines top to bottom up by n lines. Lines scrolled off the
+// top of the main screen go to the scrollback
+func (t *VT) scrollUp(top, bottom, n int) {
+	n = Min(n, bottom-top+1)
+	if top == 0 && bottom == t.Height-1 && !t.altScreen {
+		t.pushScrollback(t.lines[:n])
+	}
+	copy(t.lines[top:], t.lines[top+n:bottom+1])
+	for y := bottom - n + 1; y <= bottom; y++ {
+		t.lines[y] = t.blankLine()
+	}
+}
+
+// scrollDown moves lines top to bottom down by n lines
+func (t *VT) scrollDown(top, bottom, n int) {
+	n = Min(n, bottom-top+1)
+	copy(t.lines[top+n:bottom+1], t.lines[top:])
+	for y := top; y < top+n; y++ {
+		t.lines[y] = t.blankLine()
+	}
+}
+
+// moveTo moves the cursor, keeping it on the screen
+func (t *VT) moveTo(x, y int) {
+	t.cx = Min(Max(x, 0), t.Width-1)
+	t.cy = Min(Max(y, 0), t.Height-1)
+	t.wrapNext = false
+}
+
+func (t *VT) eraseLines(start, end int) {
+	for y := start; y < end; y++ {
+		t.lines[y] = t.blankLine()
+	}
+}
+
+func (t *VT) eraseCells(y, start, end int) {
+	for x := Max(start, 0); x < end && x < t.Width; x++ {
+		t.lines[y][x] = vtCell{' ', tcell.StyleDefault}
+	}
+}
+
+func (t *VT) saveCursor() {
+	t.savedX, t.savedY, t.savedStyle = t.cx, t.cy, t.style
+}
+
+func (t *VT) restoreCursor() {
+	t.style = t.savedStyle
+	t.moveTo(t.savedX, t.savedY)
+}
+
+// csi handles a control sequence, made of the parameters and the final
+// character
+func (t *VT) csi(params string, final rune) {
+	var private byte
+	if params != "" && strings.IndexByte("?<=>", params[0]) >= 0 {
+		private, params = params[0], params[1:]
+	}
+	if strings.IndexFunc(params, func(r rune) bool { return r < '0' }) >= 0 {
+		// Sequences with intermediate characters, such as the one setting
+		// the cursor shape, aren't supported
+		return
+	}
+	var args []int
+	if params != "" {
+		for _, p := range strings.FieldsFunc(params, func(r rune) bool { return r == ';' || r == ':' }) {
+			n, _ := strconv.Atoi(p)
+			args = append(args, n)
+		}
+	}
+	// arg returns the ith argument, or def if it is missing or zero
+	arg := func(i, def int) int {
+		if i < len(args) && args[i] > 0 {
+			return args[i]
+		}
+		return def
+	}
+
+	if private != 0 && final != 'h' && final != 'l' && final != 'c' {
+		return
+	}
+	switch final {
+	case 'A':
+		top := 0
+		if t.cy >= t.top {
+			top = t.top
+		}
+		t.moveTo(t.cx, Max(t.cy-arg(0, 1), top))
+	case 'B', 'e':
+		bottom := t.Height - 1
+		if t.cy <= t.bottom {
+			bottom = t.bottom
+		}
+		t.moveTo(t.cx, Min(t.cy+arg(0, 1), bottom))
+	case 'C', 'a':
+		t.moveTo(t.cx+arg(0, 1), t.cy)
+	case 'D':
+		t.moveTo(t.cx-arg(0, 1), t.cy)
+	case 'E':
+		t.moveTo(0, t.cy+arg(0, 1))
+	case 'F':
+		t.moveTo(0, t.cy-arg(0, 1))
+	case 'G', '`':
+		t.moveTo(arg(0, 1)-1, t.cy)
+	case 'd':
+		t.moveTo(t.cx, arg(0, 1)-1)
+	case 'H', 'f':
+		t.moveTo(arg(1, 1)-1, arg(0, 1)-1)
+	case 'J':
+		switch arg(0, 0) {
+		case 0:
+			t.eraseCells(t.cy, t.cx, t.Width)
+			t.eraseLines(t.cy+1, t.Height)
+		case 1:
+			t.eraseLines(0, t.cy)
+			t.eraseCells(t.cy, 0, t.cx+1)
+		case 2:
+			t.eraseLines(0, t.Height)
+		case 3:
+			t.eraseLines(0, t.Height)
+			t.scrollback = nil
+		}
+	case 'K':
+		switch arg(0, 0) {
+		case 0:
+			t.eraseCells(t.cy, t.cx, t.Width)
+		case 1:
+			t.eraseCells(t.cy, 0, t.cx+1)
+		case 2:
+			t.eraseCells(t.cy, 0, t.Width)
+		}
+	case 'X':
+		t.eraseCells(t.cy, t.cx, t.cx+arg(0, 1))
+	case 'L':
+		if t.cy >= t.top && t.cy <= t.bottom {
+			t.scrollDown(t.cy, t.bottom, arg(0, 1))
+			t.cx = 0
+		}
+	case 'M':
+		if t.cy >= t.top && t.cy <= t.bottom {
+			// Deleted lines never go to the scrollback
+			n := Min(arg(0, 1), t.bottom-t.cy+1)
+			copy(t.lines[t.cy:], t.lines[t.cy+n:t.bottom+1])
+			t.eraseLines(t.bottom-n+1, t.bottom+1)
+			t.cx = 0
+		}
+	case '@':
+		line := t.lines[t.cy]
+		n := Min(arg(0, 1), t.Width-t.cx)
+		copy(line[t.cx+n:], line[t.cx:])
+		t.eraseCells(t.cy, t.cx, t.cx+n)
+	case 'P':
+		line := t.lines[t.cy]
+		n := Min(arg(0, 1), t.Width-t.cx)
+		copy(line[t.cx:], line[t.cx+n:])
+		t.eraseCells(t.cy, t.Width-n, t.Width)
+	case 'S':
+		t.scrollUp(t.top, t.bottom, arg(0, 1))
+	case 'T':
+		t.scrollDown(t.top, t.bottom, arg(0, 1))
+	case 'r':
+		top, bottom := arg(0, 1)-1, arg(1, t.Height)-1
+		if top < bottom && bottom < t.Height {
+			t.top, t.bottom = top, bottom
+			t.moveTo(0, 0)
+		}
+	case 's':
+		t.saveCursor()
+	case 'u':
+		t.restoreCursor()
+	case 'm':
+		t.sgr(args)
+	case 'h', 'l':
+		for _, mode := range args {
+			t.setMode(private, mode, final == 'h')
+		}
+	case 'n':
+		switch arg(0, 0) {
+		case 5:
+			t.send("\x1b[0n")
+		case 6:
+			t.send("\x1b[" + strconv.Itoa(t.cy+1) + ";" + strconv.Itoa(t.cx+1) + "R")
+		}
+	case 'c':
+		switch private {
+		case 0:
+			t.send("\x1b[?1;2c")
+		case '>':
+			t.send("\x1b[>0;0;0c")
+		}
+	}
+}
+
+func (t *VT) send(s string) {
+	if t.reply != nil {
+		t.reply([]byte(s))
+	}
+}
+
+// sgr sets the attributes of the text printed next
+func (t *VT) sgr(args []int) {
+	if len(args) == 0 {
+		args = []int{0}
+	}
+	for i := 0; i < len(args); i++ {
+		switch n := args[i]; {
+		case n == 0:
+			t.style = tcell.StyleDefault
+		case n == 1:
+			t.style = t.style.Bold(true)
+		case n == 2:
+			t.style = t.style.Dim(true)
+		case n == 4:
+			t.style = t.style.Underline(true)
+		case n == 5 || n == 6:
+			t.style = t.style.Blink(true)
+		case n == 7:
+			t.style = t.style.Reverse(true)
+		case n == 21 || n == 22:
+			t.style = t.style.Bold(false).Dim(false)
+		case n == 24:
+			t.style = t.style.Underline(false)
+		case n == 25:
+			t.style = t.style.Blink(false)
+		case n == 27:
+			t.style = t.style.Reverse(false)
+		case n == 38 || n == 48 || n == 58:
+			// Skip the arguments of 256 and true colors
+			if i+1 < len(args) && args[i+1] == 5 {
+				i += 2
+			} else if i+1 < len(args) && args[i+1] == 2 {
+				i += 4
+			}
+		}
+	}
+}
+
+// setMode sets or resets a mode of the terminal
+func (t *VT) setMode(private byte, mode int, on bool) {
+	if private != '?' {
+		return
+	}
+	switch mode {
+	case 1:
+		t.appCursor = on
+	case 7:
+		t.autowrap = on
+	case 25:
+		t.cursorVisible = on
+	case 2004:
+		t.bracketedPaste = on
+	case 47, 1047, 1049:
+		if on == t.altScreen {
+			return
+		}
+		if mode == 1049 && on {
+			t.saveCursor()
+		}
+		t.altScreen = on
+		if on {
+			t.mainLines, t.lines = t.lines, nil
+			for len(t.lines) < t.Height {
+				t.lines = append(t.lines, t.blankLine())
+			}
+		} else {
+			t.lines, t.mainLines = t.mainLines, nil
+		}
+		if mode == 1049 && !on {
+			t.restoreCursor()
+		}
+		t.moveTo(t.cx, t.cy)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
@@ -120,6 +121,9 @@ func RedrawAll() {
 	}
 
 	views[mainView].Display()
+	if terminal != nil {
+		terminal.Display()
+	}
 	messenger.Display()
 	screen.Show()
 }
@@ -127,12 +131,12 @@ func RedrawAll() {
 // Passing -version as a flag will have micro print out the version number
 var flagVersion = flag.Bool("version", false, "show the version number and information.")
 var flagStartPos = flag.String("startpos", "", "LINE,COL to start the cursor at when opening a buffer.")
-var flagTabSize = flag.Int("tabsize", 4, "tab size to be used")
+var flagDumpBindings = flag.Bool("dump-bindings", false, "print the key bindings in effect as bindings.json and exit")
 
 func main() {
 	flag.Usage = func() {
 		fmt.Println("Usage: zed [OPTIONS] [FILE]")
-		fmt.Print("zed's options can be set via command line arguments for quick adjustments. For real configuration, please use the bindings.json file (see 'help options').\n\n")
+		fmt.Print("zed's options can be set via command line arguments for quick adjustments. For real configuration, please use the settings.json and bindings.json files (see 'help options').\n\n")
 		flag.PrintDefaults()
 	}
 
@@ -145,7 +149,16 @@ func main() {
 		os.Exit(0)
 	}
 
+	InitSettings()
 	InitBindings()
+	if *flagDumpBindings {
+		data, _ := json.MarshalIndent(DumpBindings(), "", "    ")
+		fmt.Println(string(data))
+		os.Exit(0)
+	}
+	InitMacros()
+	InitSnippets()
+	InitClipboard()
 
 	// Start the screen
 	InitScreen()
@@ -189,40 +202,50 @@ func main() {
 	}()
 
 	for {
+		// Add the output of commands run in the background and of the
+		// terminal pane, including any that arrived while a prompt was open
+		updateCommands()
+		updateTerminal()
+
 		// Display everything
 		RedrawAll()
 
-		var event tcell.Event
-
 		// Check for new events
-		select {
-		case event = <-events:
-		}
+		event := nextEvent()
 
 		for event != nil {
-			switch e := event.(type) {
-			case *tcell.EventResize:
-				//for _, t := range tabs {
-				//	t.Resize()
-				//}
-				views[mainView].Resize(e.Size())
-			}
+			HandleEvent(event)
 
-			if searching {
-				// Since searching is done in real time, we need to redraw every time
-				// there is a new event in the search bar so we need a special function
-				// to run instead of the standard HandleEvent.
-				HandleSearchEvent(event, views[mainView])
-			} else {
-				// Send it to the view
-				views[mainView].HandleEvent(event)
-			}
+			event = pollEvent()
+		}
+	}
+}
 
-			select {
-			case event = <-events:
-			default:
-				event = nil
-			}
+// HandleEvent sends an event to whatever should handle it
+func HandleEvent(event tcell.Event) {
+	switch e := event.(type) {
+	case *tcell.EventResize:
+		//for _, t := range tabs {
+		//	t.Resize()
+		//}
+		layout(e.Size())
+	case *commandEvent:
+		// The output is added before the next redraw
+		return
+	case *tcell.EventKey, *tcell.EventPaste:
+		if terminalFocused && !searching {
+			terminal.HandleEvent(event)
+			return
 		}
 	}
+
+	if searching {
+		// Since searching is done in real time, we need to redraw every time
+		// there is a new event in the search bar so we need a special function
+		// to run instead of the standard HandleEvent.
+		HandleSearchEvent(event, views[mainView])
+	} else {
+		// Send it to the view
+		views[mainView].HandleEvent(event)
+	}
 }